@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/jclem/alpaca/project"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func init() {
+	configCmd.Flags().StringVarP(&profile, "profile", "p", "", "Config profile to apply")
+	rootCmd.AddCommand(&configCmd)
+}
+
+var configCmd = cobra.Command{
+	Use:   "config <dir>",
+	Short: "Print the effective config of the given Alpaca project",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+
+		projectPath, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatalf("Could not resolve path %s", dir)
+		}
+
+		cfg, _, err := project.ReadConfig(projectPath, profile)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to read project config"))
+		}
+
+		bytes, err := yaml.Marshal(cfg)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Error marshalling config"))
+		}
+
+		fmt.Print(string(bytes))
+	},
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jclem/alpaca/project"
+	"github.com/jclem/alpaca/workflow"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var diffJSON bool
+var diffColor string
+
+func init() {
+	diffCmd.Flags().StringVarP(&profile, "profile", "p", "", "Config profile to build projects with")
+	diffCmd.Flags().BoolVar(&diffJSON, "json", false, "Print the differences as JSON")
+	diffCmd.Flags().StringVar(&diffColor, "color", "auto", "Whether to color the differences: auto, always, or never")
+	rootCmd.AddCommand(&diffCmd)
+}
+
+var diffCmd = cobra.Command{
+	Use:   "diff <a> <b>",
+	Short: "Print the differences between two workflows, each an Alpaca project or a packed workflow",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var color bool
+		switch diffColor {
+		case "auto":
+			color = isTerminal(os.Stdout)
+		case "always":
+			color = true
+		case "never":
+		default:
+			log.Fatalf("Unknown color mode %q, expected auto, always, or never", diffColor)
+		}
+
+		a, err := readWorkflow(args[0])
+		if err != nil {
+			log.Fatal(errors.Wrapf(err, "Unable to read %s", args[0]))
+		}
+
+		b, err := readWorkflow(args[1])
+		if err != nil {
+			log.Fatal(errors.Wrapf(err, "Unable to read %s", args[1]))
+		}
+
+		diff := workflow.Compare(a, b)
+
+		if diffJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(diff); err != nil {
+				log.Fatal(errors.Wrap(err, "Error marshalling differences"))
+			}
+			return
+		}
+
+		printDiff(os.Stdout, diff, a, b, color)
+	},
+}
+
+// readWorkflow returns a summary of the workflow file at path, or of the
+// workflow that the project at path builds, without running its hooks. The
+// objects of a project are named. Manifests are left out, since they differ
+// whenever anything else does.
+func readWorkflow(path string) (*workflow.Inspection, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var inspection *workflow.Inspection
+	if info.IsDir() {
+		projectPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := project.Load(projectPath, project.BuildOptions{Profile: profile, NoHooks: true})
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		if _, err := p.Write(project.NewZipOutput(&buf), ""); err != nil {
+			return nil, err
+		}
+
+		if inspection, err = workflow.InspectData(path, buf.Bytes()); err != nil {
+			return nil, err
+		}
+
+		names := make(map[string]string)
+		for name, obj := range p.Config.Objects {
+			names[obj.UID] = name
+		}
+		for i, obj := range inspection.Objects {
+			inspection.Objects[i].Name = names[obj.UID]
+		}
+	} else if inspection, err = workflow.Inspect(path); err != nil {
+		return nil, err
+	}
+
+	files := inspection.Files[:0]
+	for _, file := range inspection.Files {
+		if file.Path != project.ManifestName {
+			files = append(files, file)
+		}
+	}
+	inspection.Files = files
+
+	return inspection, nil
+}
+
+// printDiff prints the differences between workflows a and b, with additions
+// marked by "+", removals by "-", and changes by "~". Objects are referred to
+// by their name, if known, or by their UID and a short description. Changed
+// text files are followed by their line diff.
+func printDiff(w io.Writer, diff *workflow.Diff, a *workflow.Inspection, b *workflow.Inspection, color bool) {
+	if diff.Empty() {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+
+	marks := map[string]string{workflow.Added: "+", workflow.Removed: "-", workflow.Changed: "~"}
+	colors := map[string]string{workflow.Added: "32", workflow.Removed: "31", workflow.Changed: "33"}
+	mark := func(change string, line string) string {
+		line = marks[change] + " " + line
+		if color {
+			return "\x1b[" + colors[change] + "m" + line + "\x1b[0m"
+		}
+		return line
+	}
+
+	names := make(map[string]string)
+	for _, inspection := range []*workflow.Inspection{a, b} {
+		for _, obj := range inspection.Objects {
+			names[obj.UID] = objectName(obj)
+		}
+	}
+	name := func(uid string) string {
+		if n, ok := names[uid]; ok {
+			return n
+		}
+		return fmt.Sprintf("[%s] missing object", shortUID(uid))
+	}
+
+	fields := func(changes []workflow.FieldChange) {
+		for _, field := range changes {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", field.Field, formatChange(field.Old), formatChange(field.New))
+		}
+	}
+
+	first := true
+	heading := func(title string) {
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+		fmt.Fprintf(w, "%s:\n", title)
+	}
+
+	if len(diff.Metadata) > 0 {
+		heading("Metadata")
+		for _, field := range diff.Metadata {
+			fmt.Fprintln(w, mark(workflow.Changed, fmt.Sprintf("%s: %s -> %s", field.Field, formatChange(field.Old), formatChange(field.New))))
+		}
+	}
+
+	if len(diff.Objects) > 0 {
+		heading("Objects")
+		for _, change := range diff.Objects {
+			label := objectName(change.Object())
+			if change.Change == workflow.Changed && change.Old.UID != change.New.UID {
+				label = objectName(*change.Old) + " -> " + objectName(*change.New)
+			}
+			fmt.Fprintln(w, mark(change.Change, label))
+			fields(change.Fields)
+		}
+	}
+
+	if len(diff.Connections) > 0 {
+		heading("Connections")
+		for _, change := range diff.Connections {
+			line := name(change.From) + " -> " + name(change.To)
+			if change.Mod != "" {
+				line += " with " + change.Mod
+			}
+			fmt.Fprintln(w, mark(change.Change, line))
+			fields(change.Fields)
+		}
+	}
+
+	if len(diff.Variables) > 0 {
+		heading("Variables")
+		for _, change := range diff.Variables {
+			switch change.Change {
+			case workflow.Added:
+				fmt.Fprintln(w, mark(change.Change, formatVariable(*change.New)))
+			case workflow.Removed:
+				fmt.Fprintln(w, mark(change.Change, formatVariable(*change.Old)))
+			default:
+				fmt.Fprintln(w, mark(change.Change, formatVariable(*change.Old)+" -> "+formatVariable(*change.New)))
+			}
+		}
+	}
+
+	if len(diff.Files) > 0 {
+		heading("Files")
+		for _, change := range diff.Files {
+			switch change.Change {
+			case workflow.Added:
+				fmt.Fprintln(w, mark(change.Change, fmt.Sprintf("%s (%d bytes)", change.New.Path, change.New.Size)))
+			case workflow.Removed:
+				fmt.Fprintln(w, mark(change.Change, fmt.Sprintf("%s (%d bytes)", change.Old.Path, change.Old.Size)))
+			default:
+				fmt.Fprintln(w, mark(change.Change, fmt.Sprintf("%s (%d -> %d bytes)", change.New.Path, change.Old.Size, change.New.Size)))
+			}
+
+			for _, line := range change.Diff {
+				if color && strings.HasPrefix(line, "+") {
+					line = "\x1b[" + colors[workflow.Added] + "m" + line + "\x1b[0m"
+				} else if color && strings.HasPrefix(line, "-") {
+					line = "\x1b[" + colors[workflow.Removed] + "m" + line + "\x1b[0m"
+				}
+				fmt.Fprintln(w, strings.TrimRight("    "+line, " "))
+			}
+		}
+	}
+}
+
+// objectName returns the name of an object, if known, and its description.
+func objectName(obj workflow.InspectedObject) string {
+	if obj.Name != "" {
+		return fmt.Sprintf("%s (%s)", obj.Name, obj.Label())
+	}
+	return fmt.Sprintf("[%s] %s", shortUID(obj.UID), obj.Label())
+}
+
+// formatChange formats the old or new value of a changed field, which is
+// nil if the field is unset.
+func formatChange(value interface{}) string {
+	if value == nil {
+		return "unset"
+	}
+	return formatSetting(value)
+}
+
+func formatVariable(v workflow.InspectedVariable) string {
+	s := fmt.Sprintf("%s = %q", v.Name, v.Value)
+	if v.Exported {
+		s += " (exported)"
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jclem/alpaca/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := readWorkflow("./fixtures/diff_test/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := readWorkflow("./fixtures/diff_test/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := workflow.Compare(a, b)
+
+	// The renamed script filter is matched by its keyword.
+	if assert.Len(t, diff.Objects, 2) {
+		assert.Equal(t, workflow.Removed, diff.Objects[0].Change)
+		assert.Equal(t, "copy", diff.Objects[0].Old.Name)
+
+		assert.Equal(t, workflow.Changed, diff.Objects[1].Change)
+		assert.Equal(t, "search", diff.Objects[1].Old.Name)
+		assert.Equal(t, "find", diff.Objects[1].New.Name)
+		assert.Equal(t, workflow.FieldChange{
+			Field: "escaping",
+			Old:   []string{"spaces"},
+			New:   []string{"spaces", "dollars"},
+		}, diff.Objects[1].Fields[1])
+	}
+
+	var buf bytes.Buffer
+	printDiff(&buf, diff, a, b, false)
+	assert.Equal(t, `Metadata:
+~ version: "0.1.0" -> "0.2.0"
+
+Objects:
+- copy (clipboard)
+~ search (script-filter "search") -> find (script-filter "search")
+    uid: "`+diff.Objects[1].Old.UID+`" -> "`+diff.Objects[1].New.UID+`"
+    escaping: [spaces] -> [spaces, dollars]
+
+Connections:
+~ find (script-filter "search") -> open (open-url) with cmd
+    mod_subtitle: "Open" -> "Open in browser"
++ find (script-filter "search") -> notify (notification "{query}") with alt
+- find (script-filter "search") -> copy (clipboard)
+
+Variables:
+~ GREETING = "Hello" -> GREETING = "Hi"
++ NAME = "world"
+
+Files:
+~ alpaca.yml (481 -> 500 bytes)
+    @@ -1,26 +1,25 @@
+      name: diff_test
+    - version: 0.1.0
+    + version: 0.2.0
+      bundle-id: com.example.diff-test
+
+      variables:
+    -   GREETING: Hello
+    +   GREETING: Hi
+    +   NAME: world
+
+      objects:
+    -   search:
+    +   find:
+          type: script-filter
+          config:
+            keyword: search
+    -       escaping: [spaces]
+    +       escaping: [spaces, dollars]
+            script:
+              path: scripts/search.sh
+          then:
+    -       - object: copy
+            - object: open
+              mod: cmd
+    -         mod-subtitle: Open
+    -
+    -   copy:
+    -     type: clipboard
+    +         mod-subtitle: Open in browser
+    +       - object: notify
+    +         mod: alt
+
+        open:
+          type: open-url
++ notes.txt (26 bytes)
+~ scripts/search.sh (33 -> 52 bytes)
+    @@ -1,2 +1,2 @@
+      #!/bin/sh
+    - echo "{\"items\": []}"
+    + echo "{\"items\": [{\"title\": \"$1\"}]}"
+`, buf.String())
+
+	// Changed text files are diffed line by line.
+	if assert.Len(t, diff.Files, 3) {
+		assert.Equal(t, []string{
+			"@@ -1,2 +1,2 @@",
+			"  #!/bin/sh",
+			`- echo "{\"items\": []}"`,
+			`+ echo "{\"items\": [{\"title\": \"$1\"}]}"`,
+		}, diff.Files[2].Diff)
+	}
+
+	buf.Reset()
+	printDiff(&buf, diff, a, b, true)
+	assert.Contains(t, buf.String(), "\x1b[32m+ NAME = \"world\"\x1b[0m\n")
+	assert.Contains(t, buf.String(), "    \x1b[31m- version: 0.1.0\x1b[0m\n")
+}
+
+func TestDiffPackedWorkflow(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/diff_test/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+	defer os.RemoveAll(out)
+
+	packed, err := readWorkflow(filepath.Join(out, "diff_test.alfredworkflow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project, err := readWorkflow(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := workflow.Compare(packed, project)
+	assert.True(t, diff.Empty())
+
+	var buf bytes.Buffer
+	printDiff(&buf, diff, packed, project, false)
+	assert.Equal(t, "No differences\n", buf.String())
+}
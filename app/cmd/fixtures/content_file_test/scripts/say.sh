@@ -0,0 +1 @@
+say "$1"
@@ -0,0 +1,3 @@
+module example.com/go_script_test
+
+go 1.12
@@ -0,0 +1,7 @@
+#!/bin/bash
+# Prints one item per argument, after an invalid one.
+printf '{"items": [{"title": "Invalid", "valid": false}'
+for arg in "$@"; do
+  printf ', {"title": "%s", "arg": "%s"}' "$arg" "$arg"
+done
+printf ']}'
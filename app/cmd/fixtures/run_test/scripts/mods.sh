@@ -0,0 +1,19 @@
+#!/bin/bash
+# Prints an item with a cmd modifier and variables.
+cat <<JSON
+{
+  "variables": {"SOURCE": "mods"},
+  "items": [
+    {
+      "title": "First",
+      "arg": "first",
+      "variables": {"CHOICE": "plain"},
+      "mods": {
+        "cmd": {"arg": "first-cmd", "variables": {"CHOICE": "cmd"}},
+        "alt": {"valid": false}
+      }
+    },
+    {"title": "Second", "arg": ["second", "2"]}
+  ]
+}
+JSON
@@ -0,0 +1,2 @@
+# Runs without a shebang line or executable bit, as Alfred runs it with bash.
+printf "plain %s" "$1"
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/jclem/alpaca/project"
+	"github.com/jclem/alpaca/workflow"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var graphFormat string
+
+func init() {
+	graphCmd.Flags().StringVarP(&profile, "profile", "p", "", "Config profile to apply")
+	graphCmd.Flags().StringVar(&graphFormat, "format", "dot", "Format of the graph, dot, mermaid, or svg")
+	rootCmd.AddCommand(&graphCmd)
+}
+
+var graphCmd = cobra.Command{
+	Use:   "graph <dir>",
+	Short: "Print the graph of objects and connections of the given Alpaca project",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+
+		if graphFormat != "dot" && graphFormat != "mermaid" && graphFormat != "svg" {
+			log.Fatalf("Unknown format %q, expected dot, mermaid, or svg", graphFormat)
+		}
+
+		projectPath, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatalf("Could not resolve path %s", dir)
+		}
+
+		cfg, _, err := project.ReadConfig(projectPath, profile)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to read project config"))
+		}
+
+		graph, err := workflow.NewGraph(*cfg)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to build graph"))
+		}
+
+		switch graphFormat {
+		case "dot":
+			fmt.Print(graph.DOT())
+		case "mermaid":
+			fmt.Print(graph.Mermaid())
+		case "svg":
+			fmt.Print(graph.SVG())
+		}
+	},
+}
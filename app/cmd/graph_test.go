@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jclem/alpaca/project"
+	"github.com/jclem/alpaca/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func readGraph(t *testing.T, fixture string) *workflow.Graph {
+	dir, err := filepath.Abs(filepath.Join("./fixtures", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := workflow.NewGraph(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return graph
+}
+
+func TestGraphDOT(t *testing.T) {
+	graph := readGraph(t, "workflow_test")
+
+	dot := graph.DOT()
+	assert.True(t, strings.HasPrefix(dot, "digraph \"workflow_test\" {\n  rankdir=LR;\n"))
+	assert.Contains(t, dot, `  "search" [label="search\nscript-filter\nkeyword: search"];`)
+	assert.Contains(t, dot, `  "copy" [label="copy\nclipboard"];`)
+	assert.Contains(t, dot, `  "search" -> "copy";`)
+	assert.Contains(t, dot, `  "search" -> "open" [label="cmd: Open \"{query}\""];`)
+}
+
+func TestGraphMermaid(t *testing.T) {
+	graph := readGraph(t, "workflow_test")
+
+	assert.Equal(t, `flowchart LR
+  n0["copy<br/>clipboard"]
+  n1["open<br/>open-url"]
+  n2["search<br/>script-filter<br/>keyword: search"]
+  n3["share<br/>keyword<br/>keyword: share"]
+  n4["share-script<br/>script"]
+  n5["sleep<br/>script"]
+  n6["slow<br/>keyword<br/>keyword: slow"]
+  n2 --> n0
+  n2 -->|"cmd: Open #quot;{query}#quot;"| n1
+  n3 --> n4
+  n6 --> n5
+`, graph.Mermaid())
+}
+
+func TestGraphSVG(t *testing.T) {
+	graph := readGraph(t, "workflow_test")
+
+	// Nodes are at their uidata positions: inputs in the first column, and
+	// the objects they connect to in the next.
+	nodes := make(map[string]workflow.Node)
+	for _, node := range graph.Nodes {
+		nodes[node.Name] = node
+	}
+	assert.Equal(t, int64(20), nodes["search"].X)
+	assert.Equal(t, int64(265), nodes["copy"].X)
+
+	svg := graph.SVG()
+	assert.NoError(t, xml.Unmarshal([]byte(svg), new(struct{})))
+	assert.Contains(t, svg, `<rect x="20" y="270" width="160" height="80" rx="8"/>`)
+	assert.Contains(t, svg, `<text x="100" y="332" text-anchor="middle">keyword: search</text>`)
+	assert.Contains(t, svg, `>cmd: Open &#34;{query}&#34;</text>`)
+	assert.Equal(t, 4, strings.Count(svg, `marker-end="url(#arrow)"`))
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jclem/alpaca/workflow"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var inspectJSON bool
+
+func init() {
+	inspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "Print the summary as JSON")
+	rootCmd.AddCommand(&inspectCmd)
+}
+
+var inspectCmd = cobra.Command{
+	Use:   "inspect <file.alfredworkflow>",
+	Short: "Print a summary of the metadata, objects, connections, variables, and files of a packed workflow",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+
+		inspection, err := workflow.Inspect(path)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to inspect workflow"))
+		}
+
+		if inspectJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(inspection); err != nil {
+				log.Fatal(errors.Wrap(err, "Error marshalling summary"))
+			}
+			return
+		}
+
+		printInspection(os.Stdout, inspection)
+	},
+}
+
+// printInspection prints a summary of a packed workflow. Objects are referred
+// to by the first segment of their UID and a short description.
+func printInspection(w io.Writer, inspection *workflow.Inspection) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, field := range [][2]string{
+		{"Name", inspection.Name},
+		{"Bundle ID", inspection.BundleID},
+		{"Version", inspection.Version},
+		{"Author", inspection.Author},
+		{"Description", inspection.Description},
+		{"Web address", inspection.WebAddress},
+	} {
+		if field[1] != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", field[0], field[1])
+		}
+	}
+	tw.Flush()
+
+	labels := make(map[string]string)
+	for _, obj := range inspection.Objects {
+		labels[obj.UID] = fmt.Sprintf("[%s] %s", shortUID(obj.UID), obj.Label())
+	}
+	label := func(uid string) string {
+		if l, ok := labels[uid]; ok {
+			return l
+		}
+		return fmt.Sprintf("[%s] missing object", shortUID(uid))
+	}
+
+	fmt.Fprintf(w, "\nObjects (%d):\n", len(inspection.Objects))
+	for _, obj := range inspection.Objects {
+		fmt.Fprintf(w, "  %s\n", label(obj.UID))
+
+		keys := make([]string, 0, len(obj.Config))
+		for key := range obj.Config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(w, "    %s: %s\n", key, formatSetting(obj.Config[key]))
+		}
+	}
+
+	fmt.Fprintf(w, "\nConnections (%d):\n", len(inspection.Connections))
+	for _, conn := range inspection.Connections {
+		line := fmt.Sprintf("  %s -> %s", label(conn.From), label(conn.To))
+		if conn.Mod != "" {
+			line += " with " + conn.Mod
+		}
+		if conn.ModSubtitle != "" {
+			line += fmt.Sprintf(" %q", conn.ModSubtitle)
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	fmt.Fprintf(w, "\nVariables (%d):\n", len(inspection.Variables))
+	for _, v := range inspection.Variables {
+		line := fmt.Sprintf("  %s = %q", v.Name, v.Value)
+		if v.Exported {
+			line += " (exported)"
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	fmt.Fprintf(w, "\nFiles (%d):\n", len(inspection.Files))
+	width := 0
+	for _, file := range inspection.Files {
+		if n := len(fmt.Sprint(file.Size)); n > width {
+			width = n
+		}
+	}
+	for _, file := range inspection.Files {
+		fmt.Fprintf(w, "  %*d  %s\n", width, file.Size, file.Path)
+	}
+}
+
+// formatSetting formats the value of an object's setting on one line.
+func formatSetting(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+func shortUID(uid string) string {
+	if i := strings.Index(uid, "-"); i > 0 {
+		return uid[:i]
+	}
+	return uid
+}
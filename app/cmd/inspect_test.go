@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/jclem/alpaca/workflow"
+	"github.com/stretchr/testify/assert"
+)
+
+func inspectFixture(t *testing.T, fixture string) *workflow.Inspection {
+	dir, err := filepath.Abs(filepath.Join("./fixtures", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+	defer os.RemoveAll(out)
+
+	inspection, err := workflow.Inspect(filepath.Join(out, fixture+".alfredworkflow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return inspection
+}
+
+func TestInspect(t *testing.T) {
+	inspection := inspectFixture(t, "pack_test")
+
+	assert.Equal(t, "pack_test", inspection.Name)
+	assert.Equal(t, "com.jclem.alfred.alpaca-test.say-hello", inspection.BundleID)
+	assert.Equal(t, "Jonathan Clem <jonathan@jclem.net>", inspection.Author)
+
+	objects := make(map[string]workflow.InspectedObject)
+	for _, obj := range inspection.Objects {
+		objects[obj.Label()] = obj
+	}
+
+	filter := objects[`script-filter "filter"`]
+	assert.Equal(t, "optional", filter.Config["argumenttype"])
+	assert.Equal(t, "off", filter.Config["argumenttrimmode"])
+	assert.Equal(t, []string{"spaces", "dollars"}, filter.Config["escaping"])
+	assert.Equal(t, "wait", filter.Config["queuemode"])
+	assert.Equal(t, "automatic", filter.Config["queuedelaymode"])
+	assert.Equal(t, "word-match", filter.Config["alfredfiltersresultsmatchmode"])
+	assert.Equal(t, "external", filter.Config["type"])
+	assert.Equal(t, "argv", filter.Config["scriptargtype"])
+	assert.Equal(t, "bash", objects["script"].Config["type"])
+	assert.Equal(t, "none", objects[`keyword "the-keyword"`].Config["argumenttype"])
+
+	assert.Contains(t, inspection.Connections, workflow.InspectedConnection{
+		From: objects[`keyword "the-keyword"`].UID,
+		To:   objects["applescript"].UID,
+	})
+	assert.Equal(t, []workflow.InspectedVariable{{Name: "FOO", Value: "foo", Exported: false}}, inspection.Variables)
+	assert.Contains(t, inspection.Files, workflow.InspectedFile{Path: "scripts/script.js", Size: 52})
+
+	var buf bytes.Buffer
+	printInspection(&buf, inspection)
+	assert.Contains(t, buf.String(), "Name:         pack_test\n")
+	assert.Contains(t, buf.String(), "    escaping: [spaces, dollars]\n")
+	assert.Contains(t, buf.String(), "] keyword \"the-keyword\" -> [")
+	assert.Contains(t, buf.String(), "  FOO = \"foo\"\n")
+	assert.Contains(t, buf.String(), "    52  scripts/script.js\n")
+}
+
+func TestInspectModifiers(t *testing.T) {
+	inspection := inspectFixture(t, "workflow_test")
+
+	var mods []workflow.InspectedConnection
+	for _, conn := range inspection.Connections {
+		if conn.Mod != "" {
+			mods = append(mods, conn)
+		}
+	}
+
+	if assert.Len(t, mods, 1) {
+		assert.Equal(t, "cmd", mods[0].Mod)
+		assert.Equal(t, `Open "{query}"`, mods[0].ModSubtitle)
+	}
+
+	var buf bytes.Buffer
+	printInspection(&buf, inspection)
+	assert.Contains(t, buf.String(), ` with cmd "Open \"{query}\""`)
+	assert.Contains(t, buf.String(), `  GREETING = "Hello"`)
+}
+
+func TestDecodeWorkflowConfig(t *testing.T) {
+	// Only the keys that each type of object encodes are decoded.
+	assert.Equal(t, map[string]interface{}{"argumenttype": "none", "type": uint64(0)},
+		config.DecodeWorkflowConfig("alfred.workflow.input.keyword", map[string]interface{}{"argumenttype": uint64(2), "type": uint64(0)}))
+	assert.Equal(t, map[string]interface{}{"type": "bash", "escaping": uint64(4)},
+		config.DecodeWorkflowConfig("alfred.workflow.action.script", map[string]interface{}{"type": uint64(0), "escaping": uint64(4)}))
+	assert.Equal(t, map[string]interface{}{"type": uint64(0), "escaping": uint64(4)},
+		config.DecodeWorkflowConfig("alfred.workflow.action.openurl", map[string]interface{}{"type": uint64(0), "escaping": uint64(4)}))
+	assert.Equal(t, map[string]interface{}{"argumenttype": uint64(1)},
+		config.DecodeWorkflowConfig("alfred.workflow.output.largetype", map[string]interface{}{"argumenttype": uint64(1)}))
+}
@@ -1,9 +1,99 @@
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/jclem/alpaca/project"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var trustedKeys string
 
 func init() {
+	installCmd.Flags().StringVar(&trustedKeys, "trusted-keys", "", "Path of a list of public keys, one of which must have signed the workflow (default ~/.config/alpaca/trusted-keys, if it exists)")
 	rootCmd.AddCommand(&installCmd)
 }
 
-var installCmd = cobra.Command{}
+var installCmd = cobra.Command{
+	Use:   "install <file.alfredworkflow>",
+	Short: "Install a packed workflow into Alfred",
+	Long: `Install a packed workflow into Alfred. If a list of trusted keys is configured,
+the workflow must be signed by one of them and match its manifest.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+
+		keysPath, err := trustedKeysPath()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if keysPath != "" {
+			if err := checkTrusted(path, keysPath); err != nil {
+				log.Fatal(errors.Wrapf(err, "Refusing to install %s", path))
+			}
+		}
+
+		// Alfred installs workflows opened with it.
+		if err := exec.Command("open", path).Run(); err != nil {
+			log.Fatal(errors.Wrapf(err, "Unable to open %s", path))
+		}
+	},
+}
+
+// trustedKeysPath returns the path of the list of trusted keys, or "" if none
+// is configured.
+func trustedKeysPath() (string, error) {
+	if trustedKeys != "" {
+		return trustedKeys, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil
+	}
+
+	path := filepath.Join(home, ".config", "alpaca", "trusted-keys")
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return path, nil
+}
+
+// checkTrusted returns an error unless the workflow at path is signed by one
+// of the keys listed at keysPath and matches its manifest.
+func checkTrusted(path string, keysPath string) error {
+	keys, err := project.ReadPublicKeys(keysPath)
+	if err != nil {
+		return errors.Wrap(err, "Unable to read trusted keys")
+	}
+
+	m, err := project.ReadManifest(path)
+	if err != nil {
+		return errors.Wrap(err, "Unable to read manifest")
+	}
+
+	if err := verifySignature(path, m, keys); err != nil {
+		return err
+	}
+
+	problems, err := m.Verify(path)
+	if err != nil {
+		return errors.Wrap(err, "Unable to verify workflow")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s does not match its manifest: %s", path, problems[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jclem/alpaca/project"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(&keygenCmd)
+}
+
+var keygenCmd = cobra.Command{
+	Use:   "keygen <path>",
+	Short: "Generate a key pair for signing workflows",
+	Long: `Generate an Ed25519 key pair for signing workflows, writing the private key
+to the given path and the public key alongside it with a .pub extension`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+
+		if err := project.GenerateKey(path); err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to generate key"))
+		}
+
+		fmt.Printf("Wrote private key to %s\n", path)
+		fmt.Printf("Wrote public key to %s\n", path+project.PublicKeySuffix)
+	},
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/jclem/alpaca/project"
 	"github.com/pkg/errors"
@@ -11,9 +14,26 @@ import (
 )
 
 var out string
+var profile string
+var list bool
+var unpacked bool
+var fileName string
+var manifest string
+var signingKey string
+var force bool
+var noHooks bool
 
 func init() {
-	packCmd.Flags().StringVarP(&out, "out", "o", "", "Directory to output the packaged workflow to")
+	packCmd.Flags().StringVarP(&out, "out", "o", "", "Directory to output the packaged workflow to, or \"-\" for stdout")
+	packCmd.Flags().StringVarP(&profile, "profile", "p", "", "Config profile to build with")
+	packCmd.Flags().BoolVar(&list, "list", false, "Print the files that would be packed, without packing them")
+	packCmd.Flags().BoolVar(&unpacked, "unpacked", false, "Output the workflow as a directory instead of a zipped file")
+	packCmd.Flags().StringVar(&fileName, "filename", project.DefaultFileName, "Template for the workflow file name")
+	packCmd.Flags().StringVar(&manifest, "manifest", "", "Write a manifest of packed files: \"embed\" in the workflow, to a \"file\" alongside it, or \"both\"")
+	packCmd.Flags().Lookup("manifest").NoOptDefVal = "embed"
+	packCmd.Flags().StringVar(&signingKey, "sign", "", "Path of a private key to sign the workflow's manifest with")
+	packCmd.Flags().BoolVar(&force, "force", false, "Pack the workflow even if it is up to date")
+	packCmd.Flags().BoolVar(&noHooks, "no-hooks", false, "Skip the project's pre-pack and post-pack hooks")
 	rootCmd.AddCommand(&packCmd)
 }
 
@@ -29,17 +49,167 @@ var packCmd = cobra.Command{
 			log.Fatalf("Could not resolve path %s", dir)
 		}
 
-		outDir := out
-		if outDir == "" {
-			outDir, err = os.Getwd()
+		opts := project.BuildOptions{
+			Profile:  profile,
+			FileName: fileName,
+			Force:    force,
+			NoHooks:  noHooks,
+		}
+
+		switch manifest {
+		case "":
+		case "embed":
+			opts.EmbedManifest = true
+		case "file":
+			opts.WriteManifest = true
+		case "both":
+			opts.EmbedManifest = true
+			opts.WriteManifest = true
+		default:
+			log.Fatalf("Unknown manifest mode %q, expected \"embed\", \"file\", or \"both\"", manifest)
+		}
+
+		if signingKey != "" {
+			key, err := project.ReadPrivateKey(signingKey)
+			if err != nil {
+				log.Fatal(errors.Wrap(err, "Unable to read signing key"))
+			}
+			opts.SigningKey = key
+
+			// A signature is made over the manifest, so signing implies one.
+			if !opts.EmbedManifest && !opts.WriteManifest {
+				opts.EmbedManifest = true
+			}
+		}
+
+		if !list && !unpacked && out != "-" {
+			outDir, err := outputDir()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			targetPath, upToDate, err := project.Build(projectPath, outDir, opts)
 			if err != nil {
-				err := errors.Wrap(err, "Error getting working directory")
 				log.Fatal(err)
 			}
+
+			if upToDate {
+				fmt.Printf("%s is up to date\n", targetPath)
+			}
+			return
 		}
 
-		if err := project.Build(projectPath, outDir); err != nil {
+		p, err := project.Load(projectPath, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if list {
+			names, err := p.List()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return
+		}
+
+		if out == "-" {
+			if unpacked {
+				log.Fatal("An unpacked workflow can not be written to stdout")
+			}
+
+			if opts.WriteManifest || opts.SigningKey != nil {
+				log.Fatal("A manifest file or signature can not be written alongside a workflow written to stdout")
+			}
+
+			if p, err = p.RunPrePackHooks("-"); err != nil {
+				log.Fatal(err)
+			}
+
+			if _, err := p.Write(project.NewZipOutput(os.Stdout), ""); err != nil {
+				log.Fatal(err)
+			}
+
+			if err := p.RunHooks(project.PostPack, "-"); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+
+		outDir, err := outputDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		targetPath := filepath.Join(outDir, strings.TrimSuffix(p.FileName(fileName), ".alfredworkflow"))
+
+		if p, err = p.RunPrePackHooks(targetPath); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := cleanUnpackedDir(targetPath, projectPath); err != nil {
+			log.Fatal(err)
+		}
+
+		m, err := p.Write(project.NewDirOutput(targetPath), targetPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := p.WriteManifest(m, targetPath); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := p.RunHooks(project.PostPack, targetPath); err != nil {
 			log.Fatal(err)
 		}
 	},
 }
+
+// outputDir returns the absolute path of the directory to output the workflow
+// to.
+func outputDir() (string, error) {
+	if out == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", errors.Wrap(err, "Error getting working directory")
+		}
+		return dir, nil
+	}
+
+	return filepath.Abs(out)
+}
+
+// cleanUnpackedDir removes a previously unpacked workflow at dir, refusing to
+// remove the project at projectDir, a directory containing it, or a non-empty
+// directory that isn't a workflow. Both paths must be absolute.
+func cleanUnpackedDir(dir string, projectDir string) error {
+	rel, err := filepath.Rel(dir, projectDir)
+	if err != nil {
+		return err
+	}
+	if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("Refusing to overwrite %s, which contains the project", dir)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "info.plist")); err != nil {
+		return fmt.Errorf("Refusing to overwrite %s, which is not an unpacked workflow", dir)
+	}
+
+	return os.RemoveAll(dir)
+}
@@ -1,14 +1,21 @@
 package cmd
 
 import (
+	"archive/zip"
+	"bytes"
+	"debug/macho"
 	"encoding/json"
 	"fmt"
+	"image"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sort"
 	"testing"
 
 	"github.com/groob/plist"
+	"github.com/jclem/alpaca/project"
 	"github.com/jclem/alpaca/workflow"
 	"github.com/mholt/archiver"
 	"github.com/spf13/cobra"
@@ -135,10 +142,41 @@ func TestPack(t *testing.T) {
 
 func packWorkflow(dir string) string {
 	out = mktemp()
-	packCmd.Run(&cobra.Command{}, []string{dir})
+	packCmd.Run(&cobra.Command{}, []string{copyProject(dir)})
 	return out
 }
 
+// copyProject copies the project at dir into a temporary directory, so that
+// building it doesn't write a cache or hook output into the fixtures.
+func copyProject(dir string) string {
+	temp := filepath.Join(mktemp(), filepath.Base(dir))
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(temp, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, info.Mode().Perm())
+	})
+	if err != nil {
+		panic(err)
+	}
+	return temp
+}
+
 func mktemp() string {
 	temp, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -168,3 +206,601 @@ func printJson(x interface{}) {
 	j, _ := json.Marshal(x)
 	fmt.Println(string(j))
 }
+
+func TestPackTemplates(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/template_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	zipOut := unzip(filepath.Join(out, "template_test.alfredworkflow"))
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 6, len(i.Objects))
+
+	filters := make(map[string]map[string]interface{})
+	uids := make(map[string]string)
+	for _, obj := range i.Objects {
+		config := obj["config"].(map[string]interface{})
+		switch obj["type"] {
+		case "alfred.workflow.input.scriptfilter":
+			filters[config["keyword"].(string)] = obj
+		case "alfred.workflow.action.openurl":
+			uids[config["url"].(string)] = obj["uid"].(string)
+		}
+	}
+
+	google := filters["g"]["config"].(map[string]interface{})
+	assert.True(t, google["withspace"].(bool))
+	assert.Equal(t, `echo "g"`, google["script"])
+
+	duck := filters["d"]["config"].(map[string]interface{})
+	assert.False(t, duck["withspace"].(bool))
+	assert.Equal(t, `echo "d"`, duck["script"])
+
+	googleConns := i.Connections[filters["g"]["uid"].(string)]
+	assert.Equal(t, 2, len(googleConns))
+	assert.Equal(t, uids["https://google.com/search?q={query}"], googleConns[0].To)
+
+	duckConns := i.Connections[filters["d"]["uid"].(string)]
+	assert.Equal(t, 2, len(duckConns))
+	assert.Equal(t, uids["https://duckduckgo.com/?q={query}"], duckConns[0].To)
+}
+
+func TestPackIncludes(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/include_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	zipOut := unzip(filepath.Join(out, "include_test.alfredworkflow"))
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, map[string]string{"FOO": "foo", "BAR": "bar"}, i.Variables)
+	assert.Equal(t, 3, len(i.Objects))
+
+	uids := make(map[string]string)
+	for _, obj := range i.Objects {
+		uids[obj["type"].(string)] = obj["uid"].(string)
+	}
+
+	keywordConns := i.Connections[uids["alfred.workflow.input.keyword"]]
+	assert.Equal(t, 1, len(keywordConns))
+	assert.Equal(t, uids["alfred.workflow.output.clipboard"], keywordConns[0].To)
+}
+
+func TestPackProfile(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/profile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile = "release"
+	defer func() { profile = "" }()
+	out := packWorkflow(dir)
+
+	zipOut := unzip(filepath.Join(out, "profile_test.alfredworkflow"))
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "com.jclem.alfred.alpaca-test", i.BundleID)
+	assert.Equal(t, map[string]string{"API_HOST": "api.example.com", "DEBUG": "1"}, i.Variables)
+	assert.Equal(t, "https://example.com", i.Objects[0]["config"].(map[string]interface{})["url"])
+	_, err = os.Stat(filepath.Join(zipOut, "alpaca.local.yml"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPackInterpolation(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/interpolate_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("ALPACA_TEST_AUDIENCE", "staff")
+	defer os.Unsetenv("ALPACA_TEST_AUDIENCE")
+	out := packWorkflow(dir)
+
+	zipOut := unzip(filepath.Join(out, "interpolate_test.alfredworkflow"))
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Built for staff", i.Description)
+	assert.Equal(t, "Version 1.2.3 of interpolate_test", i.Readme)
+	assert.Equal(t, map[string]string{
+		"API_HOST":  "api.example.com",
+		"PRICE":     "cost $$5",
+		"SHELL_REF": "${HOME}",
+	}, i.Variables)
+
+	for _, obj := range i.Objects {
+		config := obj["config"].(map[string]interface{})
+		switch obj["type"] {
+		case "alfred.workflow.action.openurl":
+			assert.Equal(t, "https://staff.example.com/{query}?v=1.2.3", config["url"])
+		case "alfred.workflow.action.script":
+			assert.Equal(t, "echo ${HOME}", config["script"])
+		}
+	}
+}
+
+func TestPackContentFiles(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/content_file_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	zipOut := unzip(filepath.Join(out, "content_file_test.alfredworkflow"))
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, string(readFile(filepath.Join(dir, "README.md"))), i.Readme)
+
+	config := i.Objects[0]["config"].(map[string]interface{})
+	assert.Equal(t, string(readFile(filepath.Join(dir, "scripts/say.sh"))), config["script"])
+
+	_, err = os.Stat(filepath.Join(zipOut, "scripts/say.sh"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPackScriptTypes(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/script_type_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	wfFile := filepath.Join(out, "script_type_test.alfredworkflow")
+	zipOut := unzip(wfFile)
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	types := make(map[string]interface{})
+	for _, obj := range i.Objects {
+		config := obj["config"].(map[string]interface{})
+		types[config["scriptfile"].(string)] = config["type"]
+	}
+	assert.Equal(t, uint64(3), types[""])
+	assert.Equal(t, uint64(8), types["scripts/filter.rb"])
+	assert.Equal(t, uint64(3), types["scripts/plain.py"])
+
+	archive, err := zip.OpenReader(wfFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	modes := make(map[string]os.FileMode)
+	for _, file := range archive.File {
+		modes[file.Name] = file.Mode().Perm()
+	}
+	assert.Equal(t, os.FileMode(0755), modes["scripts/filter.rb"])
+	assert.Equal(t, os.FileMode(0755), modes["scripts/plain.py"])
+}
+
+func TestPackGoScript(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/go_script_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	wfFile := filepath.Join(out, "go_script_test.alfredworkflow")
+	zipOut := unzip(wfFile)
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	config := i.Objects[0]["config"].(map[string]interface{})
+	assert.Equal(t, uint64(8), config["type"])
+	assert.Equal(t, "bin/cmd-filter", config["scriptfile"])
+
+	bin, err := macho.OpenFat(filepath.Join(zipOut, "bin/cmd-filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bin.Close()
+
+	cpus := make([]macho.Cpu, len(bin.Arches))
+	for idx, arch := range bin.Arches {
+		cpus[idx] = arch.Cpu
+	}
+	assert.Equal(t, []macho.Cpu{macho.CpuAmd64, macho.CpuArm64}, cpus)
+
+	_, err = os.Stat(filepath.Join(zipOut, "cmd/filter/main.go"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPackIgnores(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/ignore_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	archive, err := zip.OpenReader(filepath.Join(out, "ignore_test.alfredworkflow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+
+	assert.Equal(t, []string{
+		"alpaca.yml",
+		"fixtures/keep.json",
+		"info.plist",
+		"keep.log",
+		"scripts/run.sh",
+	}, names)
+}
+
+func TestPackUnpacked(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/pack_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unpacked = true
+	fileName = "{name}-{version}.alfredworkflow"
+	defer func() {
+		unpacked = false
+		fileName = project.DefaultFileName
+	}()
+	out := packWorkflow(dir)
+
+	wfDir := filepath.Join(out, "pack_test-0.1.0")
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(wfDir, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "pack_test", i.Name)
+	assert.Equal(t, readFile(filepath.Join(dir, "img/alpaca.png")), readFile(filepath.Join(wfDir, "icon.png")))
+
+	info, err := os.Stat(filepath.Join(wfDir, "scripts/script.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, os.FileMode(0111), info.Mode()&0111)
+}
+
+func TestPackUnpackedIntoProject(t *testing.T) {
+	parent, err := filepath.EvalSymlinks(mktemp())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A project that commits an unpacked workflow, packed with "-o ." from its
+	// parent directory into a directory of its own name.
+	dir := filepath.Join(parent, "pack_test")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "info.plist"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(parent); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	out = "."
+	outDir, err := outputDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Error(t, cleanUnpackedDir(filepath.Join(outDir, "pack_test"), dir))
+	assert.Error(t, cleanUnpackedDir(outDir, dir))
+	assert.FileExists(t, filepath.Join(dir, "info.plist"))
+}
+
+func TestPackManifest(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/pack_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest = "both"
+	defer func() { manifest = "" }()
+	out := packWorkflow(dir)
+
+	wfFile := filepath.Join(out, "pack_test.alfredworkflow")
+	embedded, err := project.ReadManifest(wfFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alongside, err := project.ReadManifestFile(wfFile + project.ManifestSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, embedded, alongside)
+	assert.Equal(t, "info.plist", embedded.Files[0].Path)
+	assert.Equal(t, "icon.png", embedded.Files[1].Path)
+	assert.Len(t, embedded.ConfigHash, 64)
+
+	problems, err := embedded.Verify(wfFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, problems)
+
+	// Tamper with the icon and drop the info.plist from the workflow.
+	archive, err := zip.OpenReader(wfFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(out, "tampered.alfredworkflow")
+	file, err := os.Create(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(file)
+	for _, f := range archive.File {
+		switch f.Name {
+		case "icon.png":
+			w, _ := writer.Create(f.Name)
+			w.Write([]byte("not an icon"))
+		case "info.plist":
+		default:
+			r, _ := f.Open()
+			w, _ := writer.Create(f.Name)
+			io.Copy(w, r)
+			r.Close()
+		}
+	}
+	writer.Close()
+	file.Close()
+	archive.Close()
+
+	problems, err = embedded.Verify(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []project.Problem{
+		{Path: "icon.png", Reason: fmt.Sprintf("size is 11, expected %d", embedded.Files[1].Size)},
+		{Path: "info.plist", Reason: "missing"},
+	}, problems)
+}
+
+func TestPackSigned(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/pack_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDir := mktemp()
+	key := filepath.Join(keyDir, "alpaca")
+	otherKey := filepath.Join(keyDir, "other")
+	for _, path := range []string{key, otherKey} {
+		if err := project.GenerateKey(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	signingKey = key
+	defer func() { signingKey = "" }()
+	out := packWorkflow(dir)
+
+	wfFile := filepath.Join(out, "pack_test.alfredworkflow")
+	assert.Nil(t, checkTrusted(wfFile, key+project.PublicKeySuffix))
+
+	err = checkTrusted(wfFile, otherKey+project.PublicKeySuffix)
+	assert.EqualError(t, err, fmt.Sprintf("Invalid signature for %s: Signature does not match any trusted key", wfFile))
+
+	// A list of trusted keys is accepted if any of them signed the workflow.
+	trusted := filepath.Join(keyDir, "trusted-keys")
+	keys := append(readFile(otherKey+project.PublicKeySuffix), readFile(key+project.PublicKeySuffix)...)
+	if err := ioutil.WriteFile(trusted, keys, 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, checkTrusted(wfFile, trusted))
+
+	if err := os.Remove(wfFile + project.SignatureSuffix); err != nil {
+		t.Fatal(err)
+	}
+	err = checkTrusted(wfFile, trusted)
+	assert.EqualError(t, err, fmt.Sprintf("%s is not signed, %s does not exist", wfFile, wfFile+project.SignatureSuffix))
+}
+
+func TestPackIcons(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/icon_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	zipOut := unzip(filepath.Join(out, "icon_test.alfredworkflow"))
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	decodeIcon := func(name string) image.Config {
+		config, format, err := image.DecodeConfig(bytes.NewReader(readFile(filepath.Join(zipOut, name))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "png", format)
+		return config
+	}
+
+	// Large icons are downscaled.
+	config := decodeIcon("icon.png")
+	assert.Equal(t, 256, config.Width)
+	assert.Equal(t, 256, config.Height)
+
+	icons := make(map[string][]byte)
+	for _, obj := range i.Objects {
+		keyword := obj["config"].(map[string]interface{})["keyword"].(string)
+		icons[keyword] = readFile(filepath.Join(zipOut, obj["uid"].(string)+".png"))
+	}
+
+	assert.Equal(t, readFile(filepath.Join(zipOut, "icon.png")), icons["first"])
+	assert.Equal(t, icons["first"], icons["second"])
+
+	// A GIF is re-encoded, despite its extension.
+	assert.NotEqual(t, readFile(filepath.Join(dir, "img/gif-icon.png")), icons["third"])
+	config, format, err := image.DecodeConfig(bytes.NewReader(icons["third"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "png", format)
+	assert.Equal(t, 128, config.Width)
+}
+
+func TestPackAssets(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/asset_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := packWorkflow(dir)
+
+	zipOut := unzip(filepath.Join(out, "asset_test.alfredworkflow"))
+	var i workflow.Info
+	if err := plist.Unmarshal(readFile(filepath.Join(zipOut, "info.plist")), &i); err != nil {
+		t.Fatal(err)
+	}
+
+	// Assets are packed even though .alpacaignore ignores them.
+	assert.Equal(t, readFile(filepath.Join(dir, "icons/a.png")), readFile(filepath.Join(zipOut, "icons/a.png")))
+	assert.Equal(t, readFile(filepath.Join(dir, "icons/b.png")), readFile(filepath.Join(zipOut, "icons/b.png")))
+	_, err = os.Stat(filepath.Join(zipOut, "unused.png"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Files ignored by default are not packed, even as assets.
+	_, err = os.Stat(filepath.Join(zipOut, "icons/.DS_Store"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Outside the assets directory, .alpacaignore can still pack them.
+	assert.Equal(t, readFile(filepath.Join(dir, ".DS_Store")), readFile(filepath.Join(zipOut, ".DS_Store")))
+
+	assert.Equal(t, "alfred.workflow.input.listfilter", i.Objects[0]["type"])
+	config := i.Objects[0]["config"].(map[string]interface{})
+	var items []map[string]string
+	if err := json.Unmarshal([]byte(config["items"].(string)), &items); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(items))
+	assert.Equal(t, map[string]string{"title": "A", "subtitle": "", "arg": "a", "imagefile": "icons/a.png"}, items[0])
+}
+
+func TestPackMissingIcons(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/asset_missing_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := project.Load(dir, project.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.List()
+	assert.EqualError(t, err, `Missing icons:
+  fixtures/search.json item 2: "icon/c.png" is not packed
+  object "pick" item 2: "icons/typo.png" is not packed`)
+}
+
+func TestPackCache(t *testing.T) {
+	dir := copyProject("./fixtures/pack_test")
+
+	out := mktemp()
+	opts := project.BuildOptions{}
+
+	wfFile, upToDate, err := project.Build(dir, out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upToDate)
+	first := readFile(wfFile)
+
+	_, upToDate, err = project.Build(dir, out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, upToDate)
+
+	// Changing the build options invalidates the build.
+	opts.EmbedManifest = true
+	_, upToDate, err = project.Build(dir, out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upToDate)
+
+	// A forced build compresses files from the cache.
+	opts = project.BuildOptions{Force: true}
+	_, upToDate, err = project.Build(dir, out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, upToDate)
+	assert.Equal(t, first, readFile(wfFile))
+
+	zipOut := unzip(wfFile)
+	assert.Equal(t, readFile(filepath.Join(dir, "img/alpaca.png")), readFile(filepath.Join(zipOut, "icon.png")))
+
+	_, err = os.Stat(filepath.Join(dir, project.CacheDir))
+	assert.Nil(t, err)
+}
+
+func TestPackHooks(t *testing.T) {
+	dir := copyProject("./fixtures/hook_test")
+
+	hookOut := filepath.Join(mktemp(), "post-pack")
+	os.Setenv("HOOK_TEST_OUT", hookOut)
+	defer os.Unsetenv("HOOK_TEST_OUT")
+
+	out := mktemp()
+	wfFile, _, err := project.Build(dir, out, project.BuildOptions{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files written by pre-pack hooks are packed.
+	zipOut := unzip(wfFile)
+	assert.Equal(t, "hook_test 1.2.3 com.example.hook-test\n", string(readFile(filepath.Join(zipOut, "generated.txt"))))
+	assert.Equal(t, wfFile+"\n", string(readFile(hookOut)))
+
+	_, _, err = project.Build(dir, out, project.BuildOptions{Profile: "failing", Force: true})
+	assert.EqualError(t, err, "The pre-pack hook \"echo oops >&2; exit 3\" failed: exit status 3\noops")
+
+	_, _, err = project.Build(dir, out, project.BuildOptions{Profile: "failing", Force: true, NoHooks: true})
+	assert.Nil(t, err)
+}
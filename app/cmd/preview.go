@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/jclem/alpaca/emulator"
+	"github.com/jclem/alpaca/project"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// previewItems is the number of items shown at once, as in Alfred.
+const previewItems = 9
+
+var previewSandbox bool
+
+func init() {
+	previewCmd.Flags().StringVarP(&projectDir, "dir", "d", ".", "Directory of the Alpaca project to preview")
+	previewCmd.Flags().StringVarP(&profile, "profile", "p", "", "Config profile to preview with")
+	previewCmd.Flags().BoolVar(&previewSandbox, "sandbox", false, "Run the script filter in a sandbox, with a temporary home directory and stubs of open, osascript, and pbcopy")
+	rootCmd.AddCommand(&previewCmd)
+}
+
+var previewCmd = cobra.Command{
+	Use:   "preview <object>",
+	Short: "Preview a script filter in the terminal, re-running it as you type",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+			log.Fatal("alpaca preview must be run in a terminal")
+		}
+
+		projectPath, err := filepath.Abs(projectDir)
+		if err != nil {
+			log.Fatalf("Could not resolve path %s", projectDir)
+		}
+
+		cfg, _, err := project.ReadConfig(projectPath, profile)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to read project config"))
+		}
+
+		runner := emulator.New(projectPath, cfg)
+		runner.Sandboxed = previewSandbox
+
+		name, err := runner.FindTrigger(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		preview, err := runner.Preview(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer preview.Close()
+
+		restore, err := rawMode()
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to set up the terminal"))
+		}
+
+		state := &previewState{filter: cfg.Objects[name].Config.(config.ScriptFilter)}
+		chosen := state.loop(preview)
+
+		restore()
+		fmt.Print("\x1b[H\x1b[2J")
+
+		if chosen != nil {
+			fmt.Printf("%s\n%s\n", chosen.Title, chosen.Arg)
+		}
+	},
+}
+
+// previewState is the state of the preview UI.
+type previewState struct {
+	filter config.ScriptFilter
+
+	query    string
+	result   *emulator.PreviewResult
+	selected int
+}
+
+// key is an action of a key press in the preview UI.
+type key int
+
+const (
+	keyNone key = iota
+	keyQuit
+	keyEnter
+	keyUp
+	keyDown
+	keyTab
+	keyBackspace
+	keyClear
+	keyText
+)
+
+// loop reads keys and results until the preview is quit, returning the item
+// chosen with enter, if any.
+func (s *previewState) loop(preview *emulator.Preview) *emulator.Item {
+	input := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(input)
+				return
+			}
+			data := make([]byte, n)
+			copy(data, buf[:n])
+			input <- data
+		}
+	}()
+
+	s.render()
+
+	for {
+		select {
+		case data, ok := <-input:
+			if !ok {
+				return nil
+			}
+
+			for len(data) > 0 {
+				k, text, n := parseKey(data)
+				data = data[n:]
+
+				switch s.handle(k, text) {
+				case keyQuit:
+					return nil
+				case keyEnter:
+					if item := s.current(); item != nil && item.IsValid() {
+						return item
+					}
+				case keyText:
+					preview.SetQuery(s.query)
+				}
+			}
+
+		case result := <-preview.Results():
+			s.result = &result
+			if s.selected >= len(result.Items) {
+				s.selected = 0
+			}
+		}
+
+		s.render()
+	}
+}
+
+// handle applies a key to the state, returning keyText if the query changed.
+func (s *previewState) handle(k key, text string) key {
+	switch k {
+	case keyUp:
+		if s.selected > 0 {
+			s.selected--
+		}
+	case keyDown:
+		if s.result != nil && s.selected < len(s.result.Items)-1 {
+			s.selected++
+		}
+	case keyTab:
+		if item := s.current(); item != nil && item.Autocomplete != "" {
+			s.query = item.Autocomplete
+			return keyText
+		}
+	case keyBackspace:
+		if s.query != "" {
+			_, size := utf8.DecodeLastRuneInString(s.query)
+			s.query = s.query[:len(s.query)-size]
+			return keyText
+		}
+	case keyClear:
+		s.query = ""
+		return keyText
+	case keyText:
+		s.query += text
+		return keyText
+	case keyQuit, keyEnter:
+		return k
+	}
+	return keyNone
+}
+
+// parseKey parses the first key of terminal input, returning it, its text,
+// and the number of bytes it takes.
+func parseKey(data []byte) (key, string, int) {
+	switch data[0] {
+	case 0x03, 0x04:
+		return keyQuit, "", 1
+	case '\r', '\n':
+		return keyEnter, "", 1
+	case '\t':
+		return keyTab, "", 1
+	case 0x7f, 0x08:
+		return keyBackspace, "", 1
+	case 0x15:
+		return keyClear, "", 1
+	case 0x1b:
+		if len(data) >= 3 && data[1] == '[' {
+			switch data[2] {
+			case 'A':
+				return keyUp, "", 3
+			case 'B':
+				return keyDown, "", 3
+			}
+			return keyNone, "", 3
+		}
+		return keyQuit, "", 1
+	}
+
+	r, size := utf8.DecodeRune(data)
+	if r == utf8.RuneError || !unicode.IsPrint(r) {
+		return keyNone, "", size
+	}
+	return keyText, string(r), size
+}
+
+func (s *previewState) current() *emulator.Item {
+	if s.result == nil || s.selected >= len(s.result.Items) {
+		return nil
+	}
+	return &s.result.Items[s.selected]
+}
+
+// render draws the query, the status of the script filter, and the items
+// around the selected one.
+func (s *previewState) render() {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("\x1b[1m%s\x1b[0m %s\x1b[7m \x1b[0m", s.filter.Keyword, s.query))
+
+	switch {
+	case s.result == nil:
+		lines = append(lines, dim(s.runningSubtitle()))
+	case s.result.Err != nil:
+		lines = append(lines, "\x1b[31m"+strings.Replace(s.result.Err.Error(), "\n", "\r\n", -1)+"\x1b[0m")
+	default:
+		noun := "items"
+		if len(s.result.Items) == 1 {
+			noun = "item"
+		}
+		status := fmt.Sprintf("%d %s for %q in %s", len(s.result.Items), noun, s.result.Query, s.result.Duration.Round(time.Millisecond))
+		if s.result.Query != s.query {
+			status += ", " + s.runningSubtitle()
+		}
+		lines = append(lines, dim(status))
+	}
+	lines = append(lines, "")
+
+	if s.result != nil {
+		first := 0
+		if s.selected >= previewItems {
+			first = s.selected - previewItems + 1
+		}
+
+		for i := first; i < len(s.result.Items) && i < first+previewItems; i++ {
+			lines = append(lines, s.renderItem(i, s.result.Items[i])...)
+		}
+	}
+
+	lines = append(lines, "", dim("↑/↓ select  tab autocomplete  enter choose  esc quit"))
+
+	fmt.Print("\x1b[H\x1b[2J" + strings.Join(lines, "\r\n"))
+}
+
+func (s *previewState) renderItem(i int, item emulator.Item) []string {
+	marker := "  "
+	if i == s.selected {
+		marker = "\x1b[36m>\x1b[0m "
+	}
+
+	title := item.Title
+	if !item.IsValid() {
+		title = dim(title)
+	} else {
+		title = "\x1b[1m" + title + "\x1b[0m"
+	}
+
+	lines := []string{marker + title}
+	if item.Subtitle != "" {
+		lines = append(lines, "  "+dim(item.Subtitle))
+	}
+
+	var hints []string
+	for _, name := range item.ModNames() {
+		mod := item.Mods[name]
+		hint := name
+		switch {
+		case mod.Valid != nil && !*mod.Valid:
+			hint += ": not valid"
+		case mod.Subtitle != "":
+			hint += ": " + mod.Subtitle
+		}
+		hints = append(hints, hint)
+	}
+	if len(hints) > 0 {
+		lines = append(lines, "  "+dim(strings.Join(hints, "  ")))
+	}
+
+	return lines
+}
+
+func (s *previewState) runningSubtitle() string {
+	if s.filter.RunningSubtitle != "" {
+		return s.filter.RunningSubtitle
+	}
+	return "running..."
+}
+
+func dim(s string) string {
+	return "\x1b[2m" + s + "\x1b[0m"
+}
+
+// rawMode puts the terminal in raw mode with stty, returning a function that
+// restores its previous mode.
+func rawMode() (func(), error) {
+	save := exec.Command("stty", "-g")
+	save.Stdin = os.Stdin
+	saved, err := save.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	raw := exec.Command("stty", "raw", "-echo")
+	raw.Stdin = os.Stdin
+	if err := raw.Run(); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		restore := exec.Command("stty", strings.TrimSpace(string(saved)))
+		restore.Stdin = os.Stdin
+		restore.Run()
+	}, nil
+}
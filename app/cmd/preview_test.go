@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jclem/alpaca/emulator"
+	"github.com/jclem/alpaca/project"
+	"github.com/stretchr/testify/assert"
+)
+
+func previewObject(t *testing.T, name string) *emulator.Preview {
+	dir, err := filepath.Abs("./fixtures/preview_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := emulator.New(dir, cfg).Preview(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return preview
+}
+
+func nextResult(t *testing.T, preview *emulator.Preview) emulator.PreviewResult {
+	select {
+	case result := <-preview.Results():
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a result")
+	}
+	return emulator.PreviewResult{}
+}
+
+func titles(items []emulator.Item) []string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+func TestPreviewRunBehavior(t *testing.T) {
+	preview := previewObject(t, "echo")
+	defer preview.Close()
+
+	assert.Equal(t, "", nextResult(t, preview).Query)
+
+	// The first character runs immediately, then runs wait for the queue
+	// delay after the last change.
+	preview.SetQuery("a")
+	assert.Equal(t, []string{"a"}, titles(nextResult(t, preview).Items))
+
+	preview.SetQuery("ab")
+	preview.SetQuery("abc")
+	result := nextResult(t, preview)
+	assert.Equal(t, "abc", result.Query)
+	assert.Equal(t, []string{"abc"}, titles(result.Items))
+}
+
+func TestPreviewAlfredFiltersResults(t *testing.T) {
+	preview := previewObject(t, "filtered")
+	defer preview.Close()
+
+	result := nextResult(t, preview)
+	assert.Equal(t, []string{"Search the web ()", "Web search", "Other"}, titles(result.Items))
+
+	preview.SetQuery("web se")
+	result = nextResult(t, preview)
+	assert.Equal(t, "web se", result.Query)
+	assert.Equal(t, []string{"Search the web ()", "Web search"}, titles(result.Items))
+
+	preview.SetQuery("some")
+	assert.Equal(t, []string{"Other"}, titles(nextResult(t, preview).Items))
+}
+
+func TestPreviewCloseRemovesSandbox(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "alpaca-preview-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	os.Setenv("TMPDIR", tmp)
+	defer os.Unsetenv("TMPDIR")
+
+	dir, err := filepath.Abs("./fixtures/preview_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := emulator.New(dir, cfg)
+	runner.Sandboxed = true
+	preview, err := runner.Preview("slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Close returns once the running script is killed and the sandbox is
+	// removed.
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	preview.Close()
+	assert.True(t, time.Since(start) < 2*time.Second, "Close took %s", time.Since(start))
+
+	entries, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, entries)
+}
+
+func TestFilterItems(t *testing.T) {
+	items := []emulator.Item{
+		{Title: "Search Amazon"},
+		{Title: "Amazing grace"},
+		{Title: "Panama"},
+	}
+
+	assert.Equal(t, []string{"Search Amazon", "Amazing grace"}, titles(emulator.FilterItems(items, "ama", "exact-boundary")))
+	assert.Equal(t, []string{"Amazing grace"}, titles(emulator.FilterItems(items, "ama", "exact-start")))
+	assert.Equal(t, []string{"Search Amazon"}, titles(emulator.FilterItems(items, "am sea", "word-match")))
+	assert.Equal(t, items, emulator.FilterItems(items, " ", "exact-start"))
+}
+
+func TestPreviewKeys(t *testing.T) {
+	s := &previewState{}
+	input := []byte("hé\x7fy\x1b[A\t\x15x\r")
+
+	var keys []key
+	for len(input) > 0 {
+		k, text, n := parseKey(input)
+		input = input[n:]
+		keys = append(keys, k)
+		s.handle(k, text)
+		if k == keyBackspace {
+			assert.Equal(t, "h", s.query)
+		}
+	}
+
+	assert.Equal(t, []key{keyText, keyText, keyBackspace, keyText, keyUp, keyTab, keyClear, keyText, keyEnter}, keys)
+	assert.Equal(t, "x", s.query)
+}
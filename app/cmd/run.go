@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jclem/alpaca/emulator"
+	"github.com/jclem/alpaca/project"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var projectDir string
+var runItem int
+var runMod string
+var runSandbox bool
+var runRecord string
+var runReplay string
+
+func init() {
+	runCmd.Flags().StringVarP(&projectDir, "dir", "d", ".", "Directory of the Alpaca project to run")
+	runCmd.Flags().StringVarP(&profile, "profile", "p", "", "Config profile to run with")
+	runCmd.Flags().IntVar(&runItem, "item", 0, "Number of the script filter item to action, instead of asking")
+	runCmd.Flags().StringVar(&runMod, "mod", "", "Modifier keys to hold when actioning a script filter item, such as cmd or cmd+alt")
+	runCmd.Flags().BoolVar(&runSandbox, "sandbox", false, "Run scripts in a sandbox, with a temporary home directory and stubs of open, osascript, and pbcopy")
+	runCmd.Flags().StringVar(&runRecord, "record", "", "Record the invocations of scripts to the given file")
+	runCmd.Flags().StringVar(&runReplay, "replay", "", "Replay the invocations of scripts from the given file instead of running them")
+	rootCmd.AddCommand(&runCmd)
+}
+
+var runCmd = cobra.Command{
+	Use:   "run <trigger> [query]",
+	Short: "Run a workflow locally, starting at the object with the given keyword or name",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		trigger := args[0]
+
+		var query string
+		if len(args) > 1 {
+			query = args[1]
+		}
+
+		if runRecord != "" && runReplay != "" {
+			log.Fatal("Only one of --record and --replay may be given")
+		}
+
+		projectPath, err := filepath.Abs(projectDir)
+		if err != nil {
+			log.Fatalf("Could not resolve path %s", projectDir)
+		}
+
+		cfg, _, err := project.ReadConfig(projectPath, profile)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to read project config"))
+		}
+
+		runner := emulator.New(projectPath, cfg)
+		runner.Choose = chooseItem
+		runner.Sandboxed = runSandbox
+
+		switch {
+		case runRecord != "":
+			runner.Recording = emulator.NewRecording(runRecord)
+			runner.RecordMode = emulator.Record
+		case runReplay != "":
+			recording, err := emulator.ReadRecording(runReplay)
+			if err != nil {
+				log.Fatal(errors.Wrap(err, "Unable to read recording"))
+			}
+			runner.Recording = recording
+		}
+
+		result, err := runner.Run(trigger, query)
+		if result != nil {
+			printTrace(result)
+		}
+
+		if runRecord != "" {
+			if err := runner.Recording.Write(); err != nil {
+				log.Fatal(errors.Wrap(err, "Unable to write recording"))
+			}
+			fmt.Printf("\nRecorded scripts to %s\n", runRecord)
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// printTrace prints every object visited in a workflow run, then its
+// outputs.
+func printTrace(result *emulator.Result) {
+	for _, step := range result.Trace {
+		line := fmt.Sprintf("%s%s (%s) %q", strings.Repeat("  ", step.Depth), step.Object, step.Type, step.Query)
+		if step.Note != "" {
+			line += ": " + step.Note
+		}
+		fmt.Println(line)
+
+		for _, warning := range step.Warnings {
+			indent := strings.Repeat("  ", step.Depth+1)
+			fmt.Println(indent + "warning: " + strings.Replace(warning, "\n", "\n"+indent, -1))
+		}
+	}
+
+	if len(result.Outputs) > 0 || len(result.Invocations) > 0 {
+		fmt.Println()
+	}
+
+	for _, output := range result.Outputs {
+		fmt.Println(output)
+	}
+
+	for _, invocation := range result.Invocations {
+		fmt.Printf("Ran %s\n", invocation)
+	}
+}
+
+// chooseItem prints the items of a script filter's output, then actions the
+// item given by the --item and --mod flags. Without --item, the user is asked
+// to choose when running in a terminal, and otherwise the first valid item is
+// actioned.
+func chooseItem(object string, output *emulator.ScriptFilterOutput) (emulator.Selection, bool, error) {
+	fmt.Printf("%s:\n", object)
+	printItems(os.Stdout, output.Items)
+	fmt.Println()
+
+	if runItem > 0 {
+		return emulator.Selection{Item: runItem - 1, Mod: runMod}, true, nil
+	}
+
+	if !isTerminal(os.Stdin) {
+		sel, ok, err := emulator.FirstValid(object, output)
+		sel.Mod = runMod
+		return sel, ok, err
+	}
+
+	if len(output.Items) == 0 {
+		return emulator.Selection{}, false, nil
+	}
+
+	return promptItem(bufio.NewReader(os.Stdin), output.Items)
+}
+
+// promptItem asks for the number of an item and, optionally, modifier keys,
+// until it gets a valid answer. An empty answer stops the run.
+func promptItem(in *bufio.Reader, items []emulator.Item) (emulator.Selection, bool, error) {
+	for {
+		fmt.Printf("Choose an item (1-%d), optionally with modifier keys such as \"1 cmd\", or nothing to stop: ", len(items))
+
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return emulator.Selection{}, false, err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return emulator.Selection{}, false, nil
+		}
+
+		n, convErr := strconv.Atoi(fields[0])
+		if convErr != nil || n < 1 || n > len(items) || len(fields) > 2 {
+			fmt.Println("Invalid choice")
+		} else {
+			sel := emulator.Selection{Item: n - 1}
+			if len(fields) == 2 {
+				sel.Mod = fields[1]
+			}
+			return sel, true, nil
+		}
+
+		if err == io.EOF {
+			return emulator.Selection{}, false, nil
+		}
+	}
+}
+
+// printItems prints script filter items as a table. Invalid items have no
+// number.
+func printItems(out io.Writer, items []emulator.Item) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tTITLE\tSUBTITLE\tARG\tMODS")
+
+	for i, item := range items {
+		number := strconv.Itoa(i + 1)
+		if !item.IsValid() {
+			number = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%q\t%s\n", number, item.Title, item.Subtitle, item.Arg.String(), strings.Join(item.ModNames(), ","))
+	}
+
+	w.Flush()
+}
+
+// isTerminal returns whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/jclem/alpaca/emulator"
+	"github.com/jclem/alpaca/project"
+	"github.com/stretchr/testify/assert"
+)
+
+func runWorkflow(t *testing.T, fixture string, trigger string, query string) *emulator.Result {
+	return runWorkflowChoosing(t, fixture, trigger, query, nil)
+}
+
+func runWorkflowChoosing(t *testing.T, fixture string, trigger string, query string, choose emulator.Chooser) *emulator.Result {
+	dir, err := filepath.Abs(filepath.Join("./fixtures", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := emulator.New(dir, cfg)
+	runner.Choose = choose
+
+	result, err := runner.Run(trigger, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestRun(t *testing.T) {
+	result := runWorkflow(t, "run_test", "say", "world")
+
+	greeting := "Hello, world from com.example.run-test"
+
+	assert.Equal(t, []emulator.Step{
+		{Depth: 0, Object: "say", Type: config.KeywordType, Query: "world"},
+		{Depth: 1, Object: "greet", Type: config.ScriptType, Query: "world", Note: `output "` + greeting + `"`},
+		{Depth: 2, Object: "copy", Type: config.ClipboardType, Query: greeting},
+		{Depth: 2, Object: "search", Type: config.OpenURLType, Query: greeting},
+		{Depth: 1, Object: "notify", Type: config.NotificationType, Query: "world"},
+	}, result.Trace)
+
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy", Type: config.ClipboardType, Value: greeting},
+		{Object: "search", Type: config.OpenURLType, Value: "https://example.com/?q=Hello%2C%20world%20from%20com.example.run-test"},
+		{Object: "notify", Type: config.NotificationType, Title: "Hello", Value: "world"},
+	}, result.Outputs)
+}
+
+func TestRunScriptFilter(t *testing.T) {
+	// The query is escaped, so it is passed to the script as one argument.
+	result := runWorkflow(t, "run_test", "pick", "a b")
+
+	assert.Equal(t, `chose item 2 "a b" with arg "a b"`, result.Trace[0].Note)
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy-picked", Type: config.ClipboardType, Value: "picked a b"},
+	}, result.Outputs)
+}
+
+func TestRunScriptFilterMods(t *testing.T) {
+	choose := func(sel emulator.Selection) emulator.Chooser {
+		return func(object string, output *emulator.ScriptFilterOutput) (emulator.Selection, bool, error) {
+			return sel, true, nil
+		}
+	}
+
+	result := runWorkflowChoosing(t, "run_test", "mods", "", choose(emulator.Selection{Item: 0}))
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy-plain", Type: config.ClipboardType, Value: "plain first plain mods"},
+	}, result.Outputs)
+
+	result = runWorkflowChoosing(t, "run_test", "mods", "", choose(emulator.Selection{Item: 0, Mod: "cmd"}))
+	assert.Equal(t, `chose item 1 "First" with arg "first-cmd" holding cmd`, result.Trace[0].Note)
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy-cmd", Type: config.ClipboardType, Value: "cmd first-cmd cmd mods"},
+	}, result.Outputs)
+
+	result = runWorkflowChoosing(t, "run_test", "mods", "", choose(emulator.Selection{Item: 1}))
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy-plain", Type: config.ClipboardType, Value: "plain second\t2  mods"},
+	}, result.Outputs)
+
+	dir, err := filepath.Abs("./fixtures/run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := emulator.New(dir, cfg)
+	runner.Choose = choose(emulator.Selection{Item: 0, Mod: "alt"})
+	_, err = runner.Run("mods", "")
+	assert.EqualError(t, err, `Object "mods": Item 1 "First" is not valid with alt`)
+}
+
+func TestRunPlainScriptFile(t *testing.T) {
+	// The script has no shebang line and isn't executable, so it is run by
+	// the interpreter of its type.
+	result := runWorkflow(t, "run_test", "plain", "text")
+
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy-plain-script", Type: config.ClipboardType, Value: "plain text"},
+	}, result.Outputs)
+}
+
+func TestParseScriptFilterOutput(t *testing.T) {
+	output, err := emulator.ParseScriptFilterOutput([]byte(`{
+		"rerun": 1,
+		"items": [{"title": "A", "arg": ["a", "b"], "mods": {"cmd+shift": {"subtitle": "S"}}}]
+	}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, output.Rerun)
+	assert.Equal(t, emulator.Arg{"a", "b"}, output.Items[0].Arg)
+	assert.Equal(t, "S", output.Items[0].Mods["cmd+shift"].Subtitle)
+
+	_, err = emulator.ParseScriptFilterOutput([]byte(`{
+		"rerun": 10,
+		"cache": {"loosereload": "yes"},
+		"items": [
+			{"title": "A", "valid": "true", "arg": [1]},
+			{"subtitle": "B", "icon": {"type": "image"}, "mods": {"meta": {}, "cmd": {"arg": {}}}},
+			{"title": "C", "type": "folder", "colour": "red"}
+		]
+	}`))
+	assert.EqualError(t, err, `Invalid script filter output:
+  cache.loosereload: must be a boolean, got a string
+  cache.seconds: is required
+  items[0].arg[0]: must be a string, got a number
+  items[0].valid: must be a boolean, got a string
+  items[1].icon.type: must be one of fileicon, filetype, got "image"
+  items[1].icon.path: is required
+  items[1].mods.cmd.arg: must be a string or an array of strings, got an object
+  items[1].mods.meta: Unknown modifier key "meta", expected one of: alt, cmd, ctrl, fn, shift
+  items[1].title: is required
+  items[2].colour: is not a known field
+  items[2].type: must be one of default, file, file:skipcheck, got "folder"
+  rerun: must be between 0.1 and 5, got 10`)
+
+	_, err = emulator.ParseScriptFilterOutput([]byte("{\n  \"items\": [,]\n}"))
+	assert.EqualError(t, err, "Invalid script filter output: invalid character ',' looking for beginning of value at line 2, column 13")
+}
+
+func TestRunAlfredWorkflowOutput(t *testing.T) {
+	result := runWorkflow(t, "run_test", "json", "me")
+
+	assert.Equal(t, `output alfredworkflow with arg "from me", variables CHOICE, config autopaste, clipboardtext`, result.Trace[1].Note)
+	assert.Equal(t, []string{`overriding the config key "autopaste" is not emulated`}, result.Trace[2].Warnings)
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy-json", Type: config.ClipboardType, Value: "overridden from me json"},
+		{Object: "notify-json", Type: config.NotificationType, Title: "json", Value: "from me"},
+	}, result.Outputs)
+	assert.Equal(t, "json", result.Variables["CHOICE"])
+
+	result = runWorkflow(t, "run_test", "broken", "")
+	assert.Equal(t, []string{
+		"Invalid alfredworkflow output: invalid character '}' looking for beginning of object key string at line 1, column 32; Alfred passes it on as text",
+	}, result.Trace[1].Warnings)
+	assert.Equal(t, []emulator.Output{
+		{Object: "copy-broken", Type: config.ClipboardType, Value: `{"alfredworkflow": {"arg": "x",}}`},
+	}, result.Outputs)
+
+	_, err := emulator.ParseWorkflowOutput(`{"alfredworkflow": {"arg": 1, "variables": {"A": true}, "extra": null}}`)
+	assert.EqualError(t, err, `Invalid alfredworkflow output:
+  alfredworkflow.arg: must be a string or an array of strings, got a number
+  alfredworkflow.extra: is not a known field
+  alfredworkflow.variables.A: must be a string, got a boolean`)
+
+	output, err := emulator.ParseWorkflowOutput(`{"items": []}`)
+	assert.Nil(t, output)
+	assert.Nil(t, err)
+}
+
+func TestRunSandbox(t *testing.T) {
+	os.Setenv("ALPACA_SANDBOX_LEAK", "leaked")
+	defer os.Unsetenv("ALPACA_SANDBOX_LEAK")
+
+	dir, err := filepath.Abs("./fixtures/run_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := emulator.New(dir, cfg)
+	runner.Sandboxed = true
+
+	result, err := runner.Run("sandboxed", "page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home := result.Variables["HOME_DIR"]
+	assert.True(t, strings.HasPrefix(home, os.TempDir()), home)
+	assert.Equal(t, "none", result.Variables["LEAKED"])
+	assert.Equal(t, filepath.Join(home, "Library/Application Support/Alfred/Alfred.alfredpreferences"), result.Variables["PREFS"])
+	assert.Equal(t, "saved", result.Variables["STATE"])
+	assert.Equal(t, "name: run_test", result.Variables["WORKFLOW"])
+
+	assert.Len(t, result.Invocations, 3)
+	assert.Equal(t, emulator.Invocation{Command: "open", Args: []string{"https://example.com/page"}}, result.Invocations[0])
+	assert.Equal(t, emulator.Invocation{Command: "pbcopy", Stdin: "copied"}, result.Invocations[1])
+	assert.Equal(t, "osascript", result.Invocations[2].Command)
+	assert.Equal(t, "-e", result.Invocations[2].Args[0])
+	assert.Contains(t, result.Invocations[2].Args[1], `alfred_script("")`)
+
+	// The sandbox is removed after the run.
+	_, err = os.Stat(home)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/jclem/alpaca/emulator"
+	"github.com/jclem/alpaca/project"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var testFormat string
+var testJobs int
+var testSandbox bool
+var testRecord bool
+
+func init() {
+	testCmd.Flags().StringVarP(&profile, "profile", "p", "", "Config profile to test with")
+	testCmd.Flags().StringVar(&testFormat, "format", "tap", "Format of the results, tap or junit")
+	testCmd.Flags().IntVarP(&testJobs, "jobs", "j", runtime.NumCPU(), "Number of tests to run at once")
+	testCmd.Flags().BoolVar(&testSandbox, "sandbox", true, "Run each test in a sandbox, with a temporary home directory and stubs of open, osascript, and pbcopy")
+	testCmd.Flags().BoolVar(&testRecord, "record", false, "Run the scripts of tests with a recording and record them anew, instead of replaying them")
+	rootCmd.AddCommand(&testCmd)
+}
+
+var testCmd = cobra.Command{
+	Use:   "test <dir>",
+	Short: "Run the workflow tests of the given Alpaca project",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+
+		if testFormat != "tap" && testFormat != "junit" {
+			log.Fatalf("Unknown format %q, expected tap or junit", testFormat)
+		}
+
+		projectPath, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatalf("Could not resolve path %s", dir)
+		}
+
+		cfg, configPath, err := project.ReadConfig(projectPath, profile)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to read project config"))
+		}
+
+		tests, err := project.ReadTests(projectPath, cfg, configPath)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to read tests"))
+		}
+
+		if len(tests) == 0 {
+			log.Fatalf("No tests found in %s", dir)
+		}
+
+		runner := emulator.New(projectPath, cfg)
+		runner.Sandboxed = testSandbox
+		if testRecord {
+			runner.RecordMode = emulator.Record
+		}
+
+		results := runner.RunTests(tests, testJobs)
+
+		switch testFormat {
+		case "tap":
+			writeTAP(os.Stdout, results)
+		case "junit":
+			if err := writeJUnit(os.Stdout, cfg.Name, projectPath, results); err != nil {
+				log.Fatal(errors.Wrap(err, "Unable to write results"))
+			}
+		}
+
+		for _, result := range results {
+			if !result.Passed() {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// writeTAP writes test results in the Test Anything Protocol, with the
+// failures of each test as diagnostics.
+func writeTAP(w io.Writer, results []emulator.TestResult) {
+	fmt.Fprintln(w, "TAP version 13")
+	fmt.Fprintf(w, "1..%d\n", len(results))
+
+	for i, result := range results {
+		status := "ok"
+		if !result.Passed() {
+			status = "not ok"
+		}
+		fmt.Fprintf(w, "%s %d - %s\n", status, i+1, result.Test.Title())
+
+		for _, failure := range result.Failures {
+			for _, line := range strings.Split(failure, "\n") {
+				fmt.Fprintf(w, "  # %s\n", line)
+			}
+		}
+	}
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes test results as a JUnit XML test suite. Each test case is
+// classed by the project-relative path of the file defining it.
+func writeJUnit(w io.Writer, name string, projectDir string, results []emulator.TestResult) error {
+	suite := junitSuite{Name: name, Tests: len(results)}
+
+	var total float64
+	for _, result := range results {
+		seconds := result.Duration.Seconds()
+		total += seconds
+
+		className, err := filepath.Rel(projectDir, result.Test.Source)
+		if err != nil {
+			className = result.Test.Source
+		}
+
+		c := junitCase{
+			Name:      result.Test.Title(),
+			ClassName: filepath.ToSlash(className),
+			Time:      fmt.Sprintf("%.3f", seconds),
+		}
+
+		if !result.Passed() {
+			suite.Failures++
+			c.Failure = &junitFailure{
+				Message: result.Failures[0],
+				Text:    strings.Join(result.Failures, "\n"),
+			}
+		}
+
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	return nil
+}
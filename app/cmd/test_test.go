@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/jclem/alpaca/emulator"
+	"github.com/jclem/alpaca/project"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkflowTests(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/workflow_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, configPath, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests, err := project.ReadTests(dir, cfg, configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := emulator.New(dir, cfg)
+	runner.Sandboxed = true
+
+	results := runner.RunTests(tests, 4)
+	if !assert.Len(t, results, 7) {
+		return
+	}
+
+	assert.Equal(t, "copies the greeting", results[0].Test.Title())
+	assert.Empty(t, results[0].Failures)
+	assert.Empty(t, results[1].Failures)
+	assert.Equal(t, "shares the query", results[2].Test.Title())
+	assert.Empty(t, results[2].Failures)
+
+	assert.Equal(t, filepath.Join(dir, "failing.alpaca-test.yaml"), results[3].Test.Source)
+	assert.Equal(t, []string{
+		"items: expected 1 items, got 2",
+		`clipboard: expected "Hi, world", got "Hello, world"`,
+		`variables.MISSING: expected "value", it was not set`,
+	}, results[3].Failures)
+
+	assert.Equal(t, "slow", results[4].Test.Title())
+	assert.Equal(t, []string{"Timed out after 100ms"}, results[4].Failures)
+
+	assert.Equal(t, []string{`Run failed: No object has the keyword or name "nothing"`}, results[5].Failures)
+
+	assert.Equal(t, "replays the search", results[6].Test.Title())
+	assert.Empty(t, results[6].Failures)
+
+	var tap bytes.Buffer
+	writeTAP(&tap, results[2:5])
+	assert.Equal(t, `TAP version 13
+1..3
+ok 1 - shares the query
+not ok 2 - fails
+  # items: expected 1 items, got 2
+  # clipboard: expected "Hi, world", got "Hello, world"
+  # variables.MISSING: expected "value", it was not set
+not ok 3 - slow
+  # Timed out after 100ms
+`, tap.String())
+
+	var junit bytes.Buffer
+	if err := writeJUnit(&junit, cfg.Name, dir, results); err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, junit.String(), `<testsuite name="workflow_test" tests="7" failures="3"`)
+	assert.Contains(t, junit.String(), `<testcase name="copies the greeting" classname="alpaca.yml"`)
+	assert.Contains(t, junit.String(), `<failure message="Timed out after 100ms">Timed out after 100ms</failure>`)
+}
+
+func TestWorkflowTestTimeoutKillsForks(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/workflow_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The script runs sleep in a child process, which is killed with it.
+	start := time.Now()
+	result := emulator.New(dir, cfg).RunTest(config.Test{Trigger: "slow", Timeout: "100ms"})
+	assert.Equal(t, []string{"Timed out after 100ms"}, result.Failures)
+	assert.True(t, time.Since(start) < 2*time.Second, "test ran for %s", time.Since(start))
+}
+
+func TestWorkflowTestRecording(t *testing.T) {
+	dir, err := filepath.Abs("./fixtures/workflow_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := project.ReadConfig(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := emulator.New(dir, cfg)
+
+	mismatched := runner.RunTest(config.Test{Trigger: "search", Query: "other", Recording: "search.alpaca-recording.json"})
+	if assert.Len(t, mismatched.Failures, 1) {
+		assert.Contains(t, mismatched.Failures[0], `Run failed: Object "search": Invocation does not match its recording in `+filepath.Join(dir, "search.alpaca-recording.json"))
+		assert.Contains(t, mismatched.Failures[0], "\n-     \"world\"\n+     \"other\"\n")
+	}
+
+	unreplayed := runner.RunTest(config.Test{Trigger: "copy", Recording: "search.alpaca-recording.json"})
+	assert.Equal(t, []string{`Run failed: Recorded invocations of "search" in ` + filepath.Join(dir, "search.alpaca-recording.json") + " were not replayed"}, unreplayed.Failures)
+
+	tmp, err := ioutil.TempDir("", "alpaca-recording-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "share.alpaca-recording.json")
+	test := config.Test{
+		Trigger:   "search",
+		Query:     "page",
+		Recording: path,
+		Expect:    config.Expectations{Clipboard: &[]string{"Hello, page"}[0]},
+	}
+
+	runner.RecordMode = emulator.Record
+	assert.Empty(t, runner.RunTest(test).Failures)
+
+	recording, err := emulator.ReadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.RecordMode = emulator.Replay
+	runner.Recording = recording
+	result, err := runner.Run("search", "page")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Hello, page", result.Outputs[0].Value)
+	}
+
+	_, err = runner.Run("search", "page")
+	assert.EqualError(t, err, `Object "search": No more invocations of "search" are recorded in `+path)
+}
+
+func TestWorkflowTestsShareRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alpaca-tests-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.Config{Tests: []config.Test{
+		{Trigger: "search", Recording: "search.alpaca-recording.json"},
+		{Name: "searches again", Trigger: "search", Recording: "./search.alpaca-recording.json"},
+	}}
+
+	_, err = project.ReadTests(dir, cfg, filepath.Join(dir, "alpaca.yml"))
+	assert.EqualError(t, err, `Tests "search" and "searches again" may not share the recording ./search.alpaca-recording.json`)
+}
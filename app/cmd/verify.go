@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jclem/alpaca/project"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ed25519"
+)
+
+var manifestPath string
+var publicKey string
+
+func init() {
+	verifyCmd.Flags().StringVar(&manifestPath, "manifest", "", "Path of the manifest to verify against, instead of the embedded one or the one alongside the workflow")
+	verifyCmd.Flags().StringVar(&publicKey, "pubkey", "", "Path of a public key, or a list of them, to verify the workflow's signature with")
+	rootCmd.AddCommand(&verifyCmd)
+}
+
+var verifyCmd = cobra.Command{
+	Use:   "verify <file.alfredworkflow>",
+	Short: "Verify the files of a packed workflow against its manifest",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+
+		var m *project.Manifest
+		var err error
+		if manifestPath != "" {
+			m, err = project.ReadManifestFile(manifestPath)
+		} else {
+			m, err = project.ReadManifest(path)
+		}
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to read manifest"))
+		}
+
+		if publicKey != "" {
+			keys, err := project.ReadPublicKeys(publicKey)
+			if err != nil {
+				log.Fatal(errors.Wrap(err, "Unable to read public key"))
+			}
+
+			if err := verifySignature(path, m, keys); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Verified signature of %s\n", path)
+		}
+
+		problems, err := m.Verify(path)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "Unable to verify workflow"))
+		}
+
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			fmt.Fprintf(os.Stderr, "%s does not match its manifest\n", path)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Verified %d files in %s\n", len(m.Files), path)
+	},
+}
+
+// verifySignature returns an error unless the workflow at path is signed by
+// one of keys.
+func verifySignature(path string, m *project.Manifest, keys []ed25519.PublicKey) error {
+	signature, err := project.ReadSignature(path)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(m.VerifySignature(signature, keys), "Invalid signature for %s", path)
+}
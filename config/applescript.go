@@ -7,9 +7,10 @@ import (
 
 // AppleScript is an Alfred action that runs NSAppleScript
 type AppleScript struct {
-	Cache   bool         `yaml:"cache" structs:"cachescript"`
-	Content string       `yaml:"content" structs:"-"`
-	Script  ScriptConfig `yaml:"script" structs:"-"`
+	Cache       bool         `yaml:"cache" structs:"cachescript"`
+	Content     string       `yaml:"content" structs:"-" interpolate:"-"`
+	ContentFile string       `yaml:"content-file" structs:"-"`
+	Script      ScriptConfig `yaml:"script" structs:"-"`
 }
 
 func (a *AppleScript) UnmarshalYAML(node *yaml.Node) error {
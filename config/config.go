@@ -1,24 +1,44 @@
 package config
 
 import (
-	"io/ioutil"
-	"os"
+	"fmt"
 
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
 // Config is a parsed alpaca.json file.
 type Config struct {
-	Author      string
-	BundleID    string            `yaml:"bundle-id"`
-	Description string            `yaml:"description"`
-	Icon        string            `yaml:"icon"`
+	Assets      string            `yaml:"assets,omitempty"`
+	Author      string            `yaml:"author,omitempty"`
+	BundleID    string            `yaml:"bundle-id,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Files       Files             `yaml:"files,omitempty"`
+	Fixtures    []string          `yaml:"fixtures,omitempty"`
+	Hooks       Hooks             `yaml:"hooks,omitempty"`
+	Icon        string            `yaml:"icon,omitempty"`
+	Include     []string          `yaml:"include,omitempty"`
 	Name        string            `yaml:"name"`
-	Objects     ObjectMap         `yaml:"objects"`
-	Readme      string            `yaml:"readme"`
-	URL         string            `yaml:"url"`
-	Variables   map[string]string `yaml:"variables"`
-	Version     string            `yaml:"version"`
+	Objects     ObjectMap         `yaml:"objects,omitempty"`
+	Readme      string            `yaml:"readme,omitempty"`
+	ReadmeFile  string            `yaml:"readme-file,omitempty"`
+	Tests       []Test            `yaml:"tests,omitempty"`
+	URL         string            `yaml:"url,omitempty"`
+	Variables   map[string]string `yaml:"variables,omitempty"`
+	Version     string            `yaml:"version,omitempty"`
+}
+
+// Files configures which project files are packed into the workflow.
+type Files struct {
+	Exclude   []string `yaml:"exclude,omitempty"`
+	Gitignore bool     `yaml:"gitignore,omitempty"`
+	Include   []string `yaml:"include,omitempty"`
+}
+
+// Hooks are shell commands run before and after packing the workflow.
+type Hooks struct {
+	PostPack []string `yaml:"post-pack,omitempty"`
+	PrePack  []string `yaml:"pre-pack,omitempty"`
 }
 
 // ObjectMap is a mapping of object names to objects
@@ -48,6 +68,13 @@ func (l *ThenList) UnmarshalYAML(node *yaml.Node) error {
 // Then is an object following another object.
 type Then struct {
 	Object string `yaml:"object"`
+
+	// Mod is the combination of modifier keys, joined by "+", that must be
+	// held to follow the connection, if any.
+	Mod string `yaml:"mod,omitempty"`
+
+	// ModSubtitle is the subtitle shown while the modifier keys are held.
+	ModSubtitle string `yaml:"mod-subtitle,omitempty"`
 }
 
 func (t *Then) UnmarshalYAML(node *yaml.Node) error {
@@ -63,6 +90,10 @@ func (t *Then) UnmarshalYAML(node *yaml.Node) error {
 		return err
 	}
 
+	if _, err := ModifierMask(as.Mod); err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+
 	*t = Then(as)
 
 	return nil
@@ -70,38 +101,68 @@ func (t *Then) UnmarshalYAML(node *yaml.Node) error {
 
 // UnmarshalYAML unmarshals an object.
 func (o *ObjectMap) UnmarshalYAML(node *yaml.Node) error {
-	var m map[string]Object
-	if err := node.Decode(&m); err != nil {
-		return err
+	if node.Kind != yaml.MappingNode {
+		var m map[string]Object
+		return node.Decode(&m)
 	}
 
 	*o = make(ObjectMap)
 
-	for name, obj := range m {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name := node.Content[i].Value
+
+		var obj Object
+		if err := node.Content[i+1].Decode(&obj); err != nil {
+			return errors.Wrapf(err, "Invalid object %q (line %d)", name, node.Content[i+1].Line)
+		}
+
+		if _, ok := (*o)[name]; ok {
+			return fmt.Errorf("line %d: Object %q is defined more than once", node.Content[i].Line, name)
+		}
+
 		obj.Name = name
+		obj.UID = objectUID(name)
 		(*o)[obj.Name] = obj
 	}
 
 	return nil
 }
 
-// Read parses an alpaca.json file.
+// Read parses an alpaca.json file, along with any files it includes and its
+// local override file.
 func Read(path string) (*Config, error) {
-	file, err := os.Open(path)
+	return ReadProfile(path, "")
+}
+
+// ReadProfile parses an alpaca.json file like Read, applying the overrides of
+// the given profile before those of the local override file.
+func ReadProfile(path string, profile string) (*Config, error) {
+	files, err := loadFiles(path, "", make(map[string]bool))
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	bytes, err := ioutil.ReadAll(file)
+	templates, err := readTemplates(files)
 	if err != nil {
 		return nil, err
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(bytes, &config); err != nil {
+	for _, file := range files {
+		if err := expandTemplates(file.doc, templates); err != nil {
+			return nil, errors.Wrap(err, file.path)
+		}
+	}
+
+	overlays, err := readOverlays(path, files[0], profile)
+	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	for _, ov := range overlays {
+		if err := applyOverlay(files, ov); err != nil {
+			return nil, err
+		}
+	}
+
+	return mergeFiles(files)
 }
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ObjectTypeOf returns the type of an object in an Alpaca config for the type
+// of an object in a workflow, such as "alfred.workflow.input.keyword".
+func ObjectTypeOf(workflowType string) (ObjectType, bool) {
+	for t, wt := range objectType {
+		if wt == workflowType {
+			return t, true
+		}
+	}
+	return UnknownType, false
+}
+
+// codeDecoder returns the name, or names, of a numeric code in the config of a
+// workflow object.
+type codeDecoder func(code int64) (interface{}, bool)
+
+// named returns a decoder of the codes in a table.
+func named(table map[string]int64) codeDecoder {
+	return func(code int64) (interface{}, bool) {
+		return nameOf(table, code)
+	}
+}
+
+// scriptDecoders decode the codes of a script's config.
+var scriptDecoders = map[string]codeDecoder{
+	"scriptargtype": named(scriptArgType),
+	"type":          named(scriptType),
+}
+
+// decoders map the types of objects to the keys of their workflow configs
+// whose values are numeric codes, as written by their ToWorkflowConfig, and
+// the decoders of those codes.
+var decoders = map[ObjectType]map[string]codeDecoder{
+	KeywordType: {
+		"argumenttype": named(argumentTypeCodes()),
+	},
+	ListFilterType: {
+		"argumenttype": named(argumentTypeCodes()),
+	},
+	ScriptType: scriptDecoders,
+	ScriptFilterType: {
+		"alfredfiltersresultsmatchmode": named(alfredMatchMode),
+		"argumenttrimmode":              named(argumentTrim),
+		"argumenttype":                  named(argumentTypeCodes()),
+		"escaping": func(code int64) (interface{}, bool) {
+			return escapingNames(code), true
+		},
+		"queuedelaycustom": named(queueDelayCustom),
+		"queuedelaymode":   named(queueDelayMode),
+		"queuemode":        named(queueMode),
+		"scriptargtype":    scriptDecoders["scriptargtype"],
+		"type":             scriptDecoders["type"],
+	},
+}
+
+func argumentTypeCodes() map[string]int64 {
+	codes := make(map[string]int64, len(argumentType))
+	for t, code := range argumentType {
+		codes[string(t)] = code
+	}
+	return codes
+}
+
+// DecodeWorkflowConfig returns a copy of the config of a workflow object of
+// the given workflow type with the numeric codes Alfred uses replaced by their
+// names in an Alpaca config, such as "required" for the argumenttype 0 of a
+// keyword, and a script filter's escaping bit mask replaced by a list of
+// names. Only the keys that Alpaca writes for the type are decoded, and codes
+// without a name are kept as they are.
+func DecodeWorkflowConfig(workflowType string, cfg map[string]interface{}) map[string]interface{} {
+	t, _ := ObjectTypeOf(workflowType)
+	keys := decoders[t]
+
+	decoded := make(map[string]interface{}, len(cfg))
+	for key, value := range cfg {
+		decoded[key] = value
+
+		decode, ok := keys[key]
+		if !ok {
+			continue
+		}
+
+		if code, ok := integer(value); ok {
+			if name, ok := decode(code); ok {
+				decoded[key] = name
+			}
+		}
+	}
+
+	return decoded
+}
+
+// escapingNames returns the names of the escaping options in a bit mask, in
+// order of their bits. Bits that are not options are appended as a number.
+func escapingNames(mask int64) []string {
+	names := []string{}
+	for name, bit := range escaping {
+		if mask&bit != 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return escaping[names[i]] < escaping[names[j]] })
+
+	for _, bit := range escaping {
+		mask &^= bit
+	}
+	if mask != 0 {
+		names = append(names, fmt.Sprint(mask))
+	}
+
+	return names
+}
+
+// nameOf returns the name of a code in a table.
+func nameOf(table map[string]int64, code int64) (string, bool) {
+	for name, c := range table {
+		if c == code {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// integer returns the value of an integer decoded from a property list or
+// JSON.
+func integer(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
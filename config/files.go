@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LoadFiles reads the readme file and script content files referenced by the
+// config, relative to the project directory dir, into their inline fields.
+func (c *Config) LoadFiles(dir string) error {
+	if c.ReadmeFile != "" {
+		if c.Readme != "" {
+			return fmt.Errorf("Only one of \"readme\" and \"readme-file\" may be set")
+		}
+
+		readme, err := readProjectFile(dir, c.ReadmeFile)
+		if err != nil {
+			return errors.Wrap(err, "Unable to read readme file")
+		}
+		c.Readme = readme
+	}
+
+	for name, obj := range c.Objects {
+		var err error
+
+		if cfg, ok := obj.Config.(AppleScript); ok {
+			err = loadContent(dir, &cfg.Content, cfg.ContentFile)
+			obj.Config = cfg
+		} else if script, ok := obj.Script(); ok {
+			err = script.loadContent(dir)
+			obj.setScript(script)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "Invalid object %q", name)
+		}
+
+		c.Objects[name] = obj
+	}
+
+	return nil
+}
+
+// InlinedFiles returns the project-relative paths of the script content files
+// whose contents are inlined into the workflow.
+func (c Config) InlinedFiles() []string {
+	var paths []string
+
+	for _, obj := range c.Objects {
+		if cfg, ok := obj.Config.(AppleScript); ok {
+			paths = appendNonEmpty(paths, cfg.ContentFile)
+		} else if script, ok := obj.Script(); ok {
+			paths = appendNonEmpty(paths, script.ContentFile)
+		}
+	}
+
+	return paths
+}
+
+// ReferencedFiles returns the project-relative paths of files the workflow
+// refers to at runtime, such as executable scripts and icons.
+func (c Config) ReferencedFiles() []string {
+	paths := appendNonEmpty(c.ExecutableFiles(), c.Icon)
+
+	for _, obj := range c.Objects {
+		paths = appendNonEmpty(paths, obj.Icon)
+	}
+
+	return paths
+}
+
+func (s *ScriptConfig) loadContent(dir string) error {
+	if s.ContentFile != "" && s.Path != "" {
+		return fmt.Errorf("Only one of \"path\" and \"content-file\" may be set")
+	}
+
+	return loadContent(dir, &s.Content, s.ContentFile)
+}
+
+// loadContent reads the file at the project-relative path file into content,
+// if a file is given.
+func loadContent(dir string, content *string, file string) error {
+	if file == "" {
+		return nil
+	}
+
+	if *content != "" {
+		return fmt.Errorf("Only one of \"content\" and \"content-file\" may be set")
+	}
+
+	contents, err := readProjectFile(dir, file)
+	if err != nil {
+		return errors.Wrap(err, "Unable to read content file")
+	}
+	*content = contents
+
+	return nil
+}
+
+func readProjectFile(dir string, path string) (string, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+func appendNonEmpty(paths []string, values ...string) []string {
+	for _, value := range values {
+		if value != "" {
+			paths = append(paths, value)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// includableKeys are the root keys an included config file may set.
+var includableKeys = map[string]bool{
+	"include":   true,
+	"objects":   true,
+	"templates": true,
+	"variables": true,
+}
+
+// configFile is a single config file, either the main config or one included
+// by it.
+type configFile struct {
+	path string
+	doc  *yaml.Node
+}
+
+// loadFiles reads the config file at path and, recursively, every file it
+// includes. The file at path is always first in the returned list. The parent
+// is the path of the including file, if any.
+func loadFiles(path string, parent string, seen map[string]bool) ([]configFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if seen[abs] {
+		return nil, nil
+	}
+	seen[abs] = true
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if parent != "" {
+			return nil, errors.Wrapf(err, "%s: Error reading included file", parent)
+		}
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(bytes, &doc); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	files := []configFile{{path: path, doc: &doc}}
+
+	var includes struct {
+		Include []string `yaml:"include"`
+	}
+	if err := doc.Decode(&includes); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+
+	for _, pattern := range includes.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: Invalid include pattern %q", path, pattern)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("%s: Included file %q does not exist", path, pattern)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			included, err := loadFiles(match, path, seen)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, file := range included {
+				if err := checkIncludable(file); err != nil {
+					return nil, err
+				}
+			}
+
+			files = append(files, included...)
+		}
+	}
+
+	return files, nil
+}
+
+// checkIncludable returns an error if an included file sets root keys that
+// only the main config may set.
+func checkIncludable(file configFile) error {
+	if len(file.doc.Content) == 0 {
+		return nil
+	}
+
+	root := file.doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i]
+		if !includableKeys[key.Value] {
+			return fmt.Errorf("%s: line %d: %q may only be set in the main config", file.path, key.Line, key.Value)
+		}
+	}
+
+	return nil
+}
+
+// readTemplates collects the templates defined across all config files.
+func readTemplates(files []configFile) (TemplateMap, error) {
+	templates := make(TemplateMap)
+	sources := make(map[string]string)
+
+	for _, file := range files {
+		var tmpls struct {
+			Templates TemplateMap `yaml:"templates"`
+		}
+		if err := file.doc.Decode(&tmpls); err != nil {
+			return nil, errors.Wrap(err, file.path)
+		}
+
+		for name, tmpl := range tmpls.Templates {
+			if src, ok := sources[name]; ok {
+				return nil, fmt.Errorf("Template %q is defined in both %s and %s", name, src, file.path)
+			}
+			sources[name] = file.path
+			templates[name] = tmpl
+		}
+	}
+
+	return templates, nil
+}
+
+// mergeFiles decodes each config file and merges the results into a single
+// config.
+func mergeFiles(files []configFile) (*Config, error) {
+	var merged *Config
+	objectSources := make(map[string]string)
+	variableSources := make(map[string]string)
+
+	for _, file := range files {
+		var cfg Config
+		if err := file.doc.Decode(&cfg); err != nil {
+			return nil, errors.Wrap(err, file.path)
+		}
+
+		if merged == nil {
+			merged = &cfg
+			if merged.Objects == nil {
+				merged.Objects = make(ObjectMap)
+			}
+			for name := range cfg.Objects {
+				objectSources[name] = file.path
+			}
+			for name := range cfg.Variables {
+				variableSources[name] = file.path
+			}
+			continue
+		}
+
+		for name, obj := range cfg.Objects {
+			if src, ok := objectSources[name]; ok {
+				return nil, fmt.Errorf("Object %q is defined in both %s and %s", name, src, file.path)
+			}
+			objectSources[name] = file.path
+			merged.Objects[name] = obj
+		}
+
+		for name, value := range cfg.Variables {
+			if src, ok := variableSources[name]; ok {
+				return nil, fmt.Errorf("Variable %q is defined in both %s and %s", name, src, file.path)
+			}
+			if merged.Variables == nil {
+				merged.Variables = make(map[string]string)
+			}
+			variableSources[name] = file.path
+			merged.Variables[name] = value
+		}
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	envPattern   = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+	valuePattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+)
+
+// interpolator expands environment variables and computed values in config
+// strings.
+type interpolator struct {
+	cfg       *Config
+	dir       string
+	lookupEnv func(string) (string, bool)
+	git       map[string]string
+	errs      []string
+}
+
+// Interpolate expands "${ENV_VAR}", "${ENV_VAR:-default}", and computed values
+// such as "{{ .Version }}" in the inline readme, description, variables, and
+// object configs. Script contents and readme files are left untouched, as are
+// Alfred's own "{query}" and "{var:name}" placeholders. The dir is the
+// project directory, used to compute git values.
+func (c *Config) Interpolate(dir string) error {
+	in := interpolator{
+		cfg:       c,
+		dir:       dir,
+		lookupEnv: os.LookupEnv,
+		git:       make(map[string]string),
+	}
+
+	c.Readme = in.expand("readme", c.Readme)
+	c.Description = in.expand("description", c.Description)
+
+	for name, value := range c.Variables {
+		c.Variables[name] = in.expand("variables."+name, value)
+	}
+
+	for name, obj := range c.Objects {
+		if obj.Config == nil {
+			continue
+		}
+
+		cfg := reflect.New(reflect.TypeOf(obj.Config))
+		cfg.Elem().Set(reflect.ValueOf(obj.Config))
+		in.walk(fmt.Sprintf("objects.%s.config", name), cfg.Elem())
+
+		obj.Config = cfg.Elem().Interface().(ObjectConfig)
+		c.Objects[name] = obj
+	}
+
+	if len(in.errs) > 0 {
+		sort.Strings(in.errs)
+		return fmt.Errorf("Invalid interpolation:\n  %s", strings.Join(in.errs, "\n  "))
+	}
+
+	return nil
+}
+
+// walk expands every settable string reachable from v. Struct fields tagged
+// `interpolate:"-"` are skipped.
+func (in *interpolator) walk(path string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(in.expand(path, v.String()))
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			in.walk(path, v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			in.walk(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" || field.Tag.Get("interpolate") == "-" {
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			in.walk(path+"."+name, v.Field(i))
+		}
+	}
+}
+
+func (in *interpolator) expand(path string, s string) string {
+	s = envPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		m := envPattern.FindStringSubmatch(ref)
+		if value, ok := in.lookupEnv(m[1]); ok {
+			return value
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+
+		in.errs = append(in.errs, fmt.Sprintf("%s: Environment variable %q is not set", path, m[1]))
+		return ref
+	})
+
+	return valuePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		expr := valuePattern.FindStringSubmatch(ref)[1]
+		value, err := in.value(expr)
+		if err != nil {
+			in.errs = append(in.errs, fmt.Sprintf("%s: %s", path, err))
+			return ref
+		}
+		return value
+	})
+}
+
+// value returns the value of a computed value expression.
+func (in *interpolator) value(expr string) (string, error) {
+	switch expr {
+	case ".Author":
+		return in.cfg.Author, nil
+	case ".BundleID":
+		return in.cfg.BundleID, nil
+	case ".Name":
+		return in.cfg.Name, nil
+	case ".Version":
+		return in.cfg.Version, nil
+	case "git.branch":
+		return in.gitValue(expr, "rev-parse", "--abbrev-ref", "HEAD")
+	case "git.commit":
+		return in.gitValue(expr, "rev-parse", "HEAD")
+	default:
+		return "", fmt.Errorf("Unknown value %q", expr)
+	}
+}
+
+func (in *interpolator) gitValue(expr string, args ...string) (string, error) {
+	if value, ok := in.git[expr]; ok {
+		return value, nil
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = in.dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("Unable to compute %q: %s", expr, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", errors.Wrapf(err, "Unable to compute %q", expr)
+	}
+
+	value := strings.TrimSpace(string(out))
+	in.git[expr] = value
+	return value, nil
+}
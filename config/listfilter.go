@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/fatih/structs"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ListFilter is an Alfred filter over a fixed list of items
+type ListFilter struct {
+	Argument   keywordArgumentType `yaml:"argument" structs:"argumenttype"`
+	FixedOrder bool                `yaml:"fixed-order" structs:"fixedorder"`
+	Items      []ListFilterItem    `yaml:"items" structs:"-"`
+	Keyword    string              `yaml:"keyword" structs:"keyword"`
+	Subtitle   string              `yaml:"subtitle" structs:"subtext"`
+	Title      string              `yaml:"title" structs:"title"`
+	WithSpace  bool                `yaml:"with-space" structs:"withspace"`
+}
+
+// ListFilterItem is a single item of a list filter
+type ListFilterItem struct {
+	Arg      string `yaml:"arg" json:"arg"`
+	Icon     string `yaml:"icon" json:"imagefile,omitempty"`
+	Subtitle string `yaml:"subtitle" json:"subtitle"`
+	Title    string `yaml:"title" json:"title"`
+}
+
+func (l *ListFilter) UnmarshalYAML(node *yaml.Node) error {
+	type alias ListFilter
+	as := alias{WithSpace: true}
+	if err := node.Decode(&as); err != nil {
+		return err
+	}
+
+	*l = ListFilter(as)
+
+	return nil
+}
+
+func (l ListFilter) ToWorkflowConfig() map[string]interface{} {
+	m := structs.Map(l)
+	m["argumenttype"] = argumentType[l.Argument]
+
+	items := l.Items
+	if items == nil {
+		items = []ListFilterItem{}
+	}
+
+	// Alfred stores list filter items as a JSON string. Marshalling strings
+	// can not fail.
+	bytes, _ := json.Marshal(items)
+	m["items"] = string(bytes)
+
+	return m
+}
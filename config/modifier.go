@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// modifierKeys are the bits of each modifier key in Alfred's modifier masks.
+var modifierKeys = map[string]int64{
+	"shift": 131072,
+	"ctrl":  262144,
+	"alt":   524288,
+	"cmd":   1048576,
+	"fn":    8388608,
+}
+
+// ModifierMask returns Alfred's bit mask for a combination of modifier keys
+// joined by "+", such as "cmd+alt". The mask of no modifier keys is 0.
+func ModifierMask(mod string) (int64, error) {
+	if mod == "" {
+		return 0, nil
+	}
+
+	var mask int64
+	for _, key := range strings.Split(mod, "+") {
+		bit, ok := modifierKeys[key]
+		if !ok {
+			return 0, fmt.Errorf("Unknown modifier key %q, expected one of: %s", key, strings.Join(modifierKeyNames(), ", "))
+		}
+		mask |= bit
+	}
+
+	return mask, nil
+}
+
+func modifierKeyNames() []string {
+	names := make([]string, 0, len(modifierKeys))
+	for name := range modifierKeys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ModifierNames returns the combination of modifier keys in one of Alfred's
+// bit masks, joined by "+" in order of their bits. Bits that are not modifier
+// keys are appended as a number.
+func ModifierNames(mask int64) string {
+	names := modifierKeyNames()
+	sort.Slice(names, func(i, j int) bool { return modifierKeys[names[i]] < modifierKeys[names[j]] })
+
+	var keys []string
+	for _, name := range names {
+		if mask&modifierKeys[name] != 0 {
+			keys = append(keys, name)
+			mask &^= modifierKeys[name]
+		}
+	}
+
+	if mask != 0 {
+		keys = append(keys, fmt.Sprint(mask))
+	}
+
+	return strings.Join(keys, "+")
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"github.com/fatih/structs"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Notification is an object that posts a notification
+type Notification struct {
+	Title string `yaml:"title" structs:"title"`
+	Text  string `yaml:"text" structs:"text"`
+}
+
+func (n *Notification) UnmarshalYAML(node *yaml.Node) error {
+	type alias Notification
+	as := alias{Text: "{query}"}
+	if err := node.Decode(&as); err != nil {
+		return err
+	}
+
+	*n = Notification(as)
+
+	return nil
+}
+
+func (n Notification) ToWorkflowConfig() map[string]interface{} {
+	return structs.Map(n)
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/fatih/structs"
@@ -16,6 +17,8 @@ var (
 	AppleScriptType  ObjectType = "applescript"
 	ClipboardType    ObjectType = "clipboard"
 	KeywordType      ObjectType = "keyword"
+	ListFilterType   ObjectType = "list-filter"
+	NotificationType ObjectType = "notification"
 	OpenURLType      ObjectType = "open-url"
 	ScriptType       ObjectType = "script"
 	ScriptFilterType ObjectType = "script-filter"
@@ -25,21 +28,24 @@ var (
 // Object is an object in an Alfred workflow
 type Object struct {
 	Name    string       `yaml:"-" structs:"-"`
-	Icon    string       `yaml:"icon" structs:"-"`
+	Icon    string       `yaml:"icon,omitempty" structs:"-"`
 	Type    ObjectType   `yaml:"type" structs:"-"`
 	UID     string       `yaml:"-" structs:"uid"`
-	Then    ThenList     `yaml:"then" structs:"-"`
-	Version int64        `yaml:"version" structs:"version"`
+	Then    ThenList     `yaml:"then,omitempty" structs:"-"`
+	Version int64        `yaml:"version,omitempty" structs:"version"`
 	Config  ObjectConfig `yaml:"config" structs:"-"`
 }
 
-func (o *Object) UnmarshalYAML(node *yaml.Node) error {
-	uuid, err := uuid.NewRandom()
-	if err != nil {
-		return err
-	}
-	o.UID = strings.ToUpper(uuid.String())
+// uidNamespace is the namespace of the UUIDs derived from object names.
+var uidNamespace = uuid.MustParse("18EB5C8E-8F50-4CF5-B56B-A83C87EB247A")
 
+// objectUID returns the UID of the object with the given name. UIDs are
+// derived from names, so that an object keeps its UID between builds.
+func objectUID(name string) string {
+	return strings.ToUpper(uuid.NewSHA1(uidNamespace, []byte(name)).String())
+}
+
+func (o *Object) UnmarshalYAML(node *yaml.Node) error {
 	var proxy struct {
 		Icon    string
 		Type    ObjectType
@@ -81,6 +87,18 @@ func (o *Object) UnmarshalYAML(node *yaml.Node) error {
 			return err
 		}
 		o.Config = cfg
+	case ListFilterType:
+		var cfg ListFilter
+		if err := yaml.Unmarshal(rawConfig, &cfg); err != nil {
+			return err
+		}
+		o.Config = cfg
+	case NotificationType:
+		var cfg Notification
+		if err := yaml.Unmarshal(rawConfig, &cfg); err != nil {
+			return err
+		}
+		o.Config = cfg
 	case OpenURLType:
 		var cfg OpenURL
 		if err := yaml.Unmarshal(rawConfig, &cfg); err != nil {
@@ -110,6 +128,8 @@ var objectType = map[ObjectType]string{
 	"applescript":   "alfred.workflow.action.applescript",
 	"clipboard":     "alfred.workflow.output.clipboard",
 	"keyword":       "alfred.workflow.input.keyword",
+	"list-filter":   "alfred.workflow.input.listfilter",
+	"notification":  "alfred.workflow.output.notification",
 	"open-url":      "alfred.workflow.action.openurl",
 	"script":        "alfred.workflow.action.script",
 	"script-filter": "alfred.workflow.input.scriptfilter",
@@ -122,6 +142,44 @@ func (o Object) ToWorkflowConfig() map[string]interface{} {
 	return m
 }
 
+// Script returns the script config of an object that runs a script.
+func (o Object) Script() (ScriptConfig, bool) {
+	switch cfg := o.Config.(type) {
+	case Script:
+		return cfg.Script, true
+	case ScriptFilter:
+		return cfg.Script, true
+	}
+
+	return ScriptConfig{}, false
+}
+
+// Keyword returns the keyword of an input object, if any.
+func (o Object) Keyword() string {
+	switch cfg := o.Config.(type) {
+	case Keyword:
+		return cfg.Keyword
+	case ScriptFilter:
+		return cfg.Keyword
+	case ListFilter:
+		return cfg.Keyword
+	}
+
+	return ""
+}
+
+// setScript replaces the script config of an object that runs a script.
+func (o *Object) setScript(s ScriptConfig) {
+	switch cfg := o.Config.(type) {
+	case Script:
+		cfg.Script = s
+		o.Config = cfg
+	case ScriptFilter:
+		cfg.Script = s
+		o.Config = cfg
+	}
+}
+
 // ObjectConfig is a general configuration for an object
 type ObjectConfig interface {
 	ToWorkflowConfig() map[string]interface{}
@@ -146,10 +204,17 @@ var scriptArgType = map[string]int64{
 
 // ScriptConfig is a runnable script in a workflow.
 type ScriptConfig struct {
-	ArgType string `yaml:"arg-type" structs"-"`
-	Content string `yaml:"content" structs:"script"`
-	Path    string `yaml:"path" structs:"scriptfile"`
-	Type    string `yaml:"type" structs:"-"`
+	ArgType     string `yaml:"arg-type" structs:"-"`
+	Content     string `yaml:"content" structs:"script" interpolate:"-"`
+	ContentFile string `yaml:"content-file" structs:"-"`
+	Go          string `yaml:"go" structs:"-"`
+	Path        string `yaml:"path" structs:"scriptfile"`
+	Type        string `yaml:"type" structs:"-"`
+
+	// Language is the type of a script file's contents, if known. It is
+	// the script's type, unless Alfred runs the script directly, as an
+	// "external" script.
+	Language string `yaml:"-" structs:"-"`
 }
 
 func (s ScriptConfig) ToWorkflowConfig() map[string]interface{} {
@@ -167,5 +232,19 @@ func (s ScriptConfig) ToWorkflowConfig() map[string]interface{} {
 		m["scriptargtype"] = scriptArgType[s.ArgType]
 	}
 
+	if s.Go != "" {
+		m["scriptfile"] = s.BinaryPath()
+	}
+
 	return m
 }
+
+// BinaryPath returns the path in the workflow of the binary compiled from a
+// Go script.
+func (s ScriptConfig) BinaryPath() string {
+	pkg := filepath.ToSlash(filepath.Clean(s.Go))
+	if pkg == "." {
+		return "bin/main"
+	}
+	return "bin/" + strings.Replace(pkg, "/", "-", -1)
+}
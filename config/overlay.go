@@ -0,0 +1,195 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// overlay is a partial config that overrides values in the config files it is
+// applied to.
+type overlay struct {
+	source string
+	root   *yaml.Node
+}
+
+// readOverlays returns the overlays to apply to a config: the named profile
+// from the main config file, if any, followed by the local override file, if
+// one exists.
+func readOverlays(path string, main configFile, profile string) ([]overlay, error) {
+	var overlays []overlay
+
+	if profile != "" {
+		node := mappingValue(mappingValue(main.doc, "profiles"), profile)
+		if node == nil {
+			return nil, fmt.Errorf("%s: Unknown profile %q", main.path, profile)
+		}
+		if node.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: line %d: Profile %q must be a map", main.path, node.Line, profile)
+		}
+		overlays = append(overlays, overlay{source: fmt.Sprintf("%s: profile %q", main.path, profile), root: node})
+	}
+
+	localPath, err := findLocalFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if localPath != "" {
+		bytes, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			return nil, err
+		}
+
+		var doc yaml.Node
+		if err := yaml.Unmarshal(bytes, &doc); err != nil {
+			return nil, errors.Wrap(err, localPath)
+		}
+
+		if len(doc.Content) > 0 {
+			overlays = append(overlays, overlay{source: localPath, root: doc.Content[0]})
+		}
+	}
+
+	return overlays, nil
+}
+
+// LocalPaths returns the possible paths of the local override file for the
+// config file at path, e.g. "alpaca.local.yaml" for "alpaca.yaml".
+func LocalPaths(path string) []string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	return []string{base + ".local.yaml", base + ".local.yml"}
+}
+
+func findLocalFile(path string) (string, error) {
+	for _, localPath := range LocalPaths(path) {
+		_, err := os.Stat(localPath)
+		if err == nil {
+			return localPath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// applyOverlay merges an overlay into the config files. Root fields are set on
+// the main config file, while variables and objects are merged into whichever
+// file defines them.
+func applyOverlay(files []configFile, ov overlay) error {
+	if ov.root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: Overrides must be a map", ov.source)
+	}
+
+	mainRoot := rootNode(files[0].doc)
+
+	for i := 0; i+1 < len(ov.root.Content); i += 2 {
+		key, value := ov.root.Content[i], ov.root.Content[i+1]
+
+		switch key.Value {
+		case "include", "profiles", "templates":
+			return fmt.Errorf("%s: line %d: %q can not be overridden", ov.source, key.Line, key.Value)
+		case "objects":
+			if value.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s: line %d: \"objects\" must be a map", ov.source, value.Line)
+			}
+
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				name := value.Content[j]
+				target := findDefinition(files, "objects", name.Value)
+				if target == nil {
+					return fmt.Errorf("%s: line %d: Unknown object %q", ov.source, name.Line, name.Value)
+				}
+				mergeNode(target, value.Content[j+1])
+			}
+		case "variables":
+			if value.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s: line %d: \"variables\" must be a map", ov.source, value.Line)
+			}
+
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				name := value.Content[j]
+				if target := findDefinition(files, "variables", name.Value); target != nil {
+					mergeNode(target, value.Content[j+1])
+					continue
+				}
+
+				vars := mappingValue(mainRoot, "variables")
+				if vars == nil || vars.Kind != yaml.MappingNode {
+					vars = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+					setMappingValue(mainRoot, "variables", vars)
+				}
+				vars.Content = append(vars.Content, copyNode(name), copyNode(value.Content[j+1]))
+			}
+		default:
+			if existing := mappingValue(mainRoot, key.Value); existing != nil {
+				mergeNode(existing, value)
+			} else {
+				setMappingValue(mainRoot, key.Value, copyNode(value))
+			}
+		}
+	}
+
+	return nil
+}
+
+// findDefinition returns the value node of a named entry in a root section
+// (e.g. an object in "objects") in whichever config file defines it.
+func findDefinition(files []configFile, section string, name string) *yaml.Node {
+	for _, file := range files {
+		if node := mappingValue(mappingValue(file.doc, section), name); node != nil {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// mergeNode merges src into dst. Maps are merged key by key, and any other
+// value replaces the existing one.
+func mergeNode(dst *yaml.Node, src *yaml.Node) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		*dst = *copyNode(src)
+		return
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if existing := mappingValue(dst, key.Value); existing != nil {
+			mergeNode(existing, value)
+		} else {
+			dst.Content = append(dst.Content, copyNode(key), copyNode(value))
+		}
+	}
+}
+
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+
+	keyNode := &yaml.Node{}
+	keyNode.SetString(key)
+	node.Content = append(node.Content, keyNode, value)
+}
+
+// rootNode returns the root mapping node of a document, creating one if the
+// document is empty.
+func rootNode(doc *yaml.Node) *yaml.Node {
+	if doc.Kind != yaml.DocumentNode {
+		doc.Kind = yaml.DocumentNode
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	return doc.Content[0]
+}
@@ -31,6 +31,12 @@ var queueMode = map[string]int64{
 	"terminate": 2,
 }
 
+var queueDelayMode = map[string]int64{
+	"immediate": 0,
+	"automatic": 1,
+	"custom":    2,
+}
+
 var queueDelayCustom = map[string]int64{
 	"100ms":  1,
 	"200ms":  2,
@@ -108,12 +114,10 @@ func (s ScriptFilter) ToWorkflowConfig() map[string]interface{} {
 		m["queuemode"] = queueMode[s.RunBehavior.QueueMode]
 
 		// Queue Delay
-		if s.RunBehavior.QueueDelay == "immediate" {
-			m["queuedelaymode"] = 0
-		} else if s.RunBehavior.QueueDelay == "automatic" {
-			m["queuedelaymode"] = 1
+		if s.RunBehavior.QueueDelay == "immediate" || s.RunBehavior.QueueDelay == "automatic" {
+			m["queuedelaymode"] = queueDelayMode[s.RunBehavior.QueueDelay]
 		} else if s.RunBehavior.QueueDelay != "" {
-			m["queuedelaymode"] = 2
+			m["queuedelaymode"] = queueDelayMode["custom"]
 			m["queuedelaycustom"] = queueDelayCustom[s.RunBehavior.QueueDelay]
 		}
 	}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// interpreterTypes maps interpreter names found in shebang lines to script
+// types.
+var interpreterTypes = map[string]string{
+	"bash":    "bash",
+	"sh":      "bash",
+	"zsh":     "zsh",
+	"php":     "php",
+	"ruby":    "ruby",
+	"python":  "python",
+	"python2": "python",
+	"python3": "python",
+	"perl":    "perl",
+}
+
+// extensionTypes maps script file extensions to script types.
+var extensionTypes = map[string]string{
+	".sh":          "bash",
+	".bash":        "bash",
+	".zsh":         "zsh",
+	".php":         "php",
+	".rb":          "ruby",
+	".py":          "python",
+	".pl":          "perl",
+	".applescript": "osascript-as",
+	".scpt":        "osascript-as",
+}
+
+// machOMagics are the leading bytes of Mach-O and universal binaries.
+var machOMagics = [][]byte{
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+}
+
+// ResolveScripts infers the type of every script that doesn't set one and
+// validates it. Executable scripts must exist in the project directory dir.
+func (c *Config) ResolveScripts(dir string) error {
+	for name, obj := range c.Objects {
+		script, ok := obj.Script()
+		if !ok {
+			continue
+		}
+
+		if err := script.resolve(dir); err != nil {
+			return errors.Wrapf(err, "Invalid object %q", name)
+		}
+
+		obj.setScript(script)
+		c.Objects[name] = obj
+	}
+
+	return nil
+}
+
+// ExecutableFiles returns the project-relative paths of the scripts that
+// Alfred executes directly.
+func (c Config) ExecutableFiles() []string {
+	var paths []string
+
+	for _, obj := range c.Objects {
+		if script, ok := obj.Script(); ok {
+			paths = appendNonEmpty(paths, script.Path)
+		}
+	}
+
+	return paths
+}
+
+func (s *ScriptConfig) resolve(dir string) error {
+	if s.Type != "" {
+		if _, ok := scriptType[s.Type]; !ok {
+			return fmt.Errorf("Unknown script type %q, expected one of: %s", s.Type, strings.Join(scriptTypeNames(), ", "))
+		}
+	}
+
+	if s.Go != "" {
+		return s.resolveGo(dir)
+	}
+
+	if s.Path != "" {
+		return s.resolvePath(dir)
+	}
+
+	if s.Type == "" {
+		if s.Content == "" {
+			return fmt.Errorf("Script has no \"content\" or \"path\"")
+		}
+
+		s.Type = shebangType(s.Content)
+		if s.Type == "" {
+			return fmt.Errorf("Unable to infer script type, add a shebang line or set \"type\"")
+		}
+	}
+
+	if s.Type == "external" {
+		return fmt.Errorf("Scripts of type \"external\" require a \"path\"")
+	}
+
+	return nil
+}
+
+// resolveGo validates a Go script, which is compiled into an executable
+// script when the project is built.
+func (s *ScriptConfig) resolveGo(dir string) error {
+	if s.Path != "" || s.Content != "" || s.ContentFile != "" {
+		return fmt.Errorf("Go scripts may not set \"path\", \"content\", or \"content-file\"")
+	}
+
+	if s.Type != "" && s.Type != "external" {
+		return fmt.Errorf("Go scripts must be of type \"external\", got %q", s.Type)
+	}
+	s.Type = "external"
+
+	pkg := filepath.Clean(s.Go)
+	if !insideProject(pkg) {
+		return fmt.Errorf("Go package %q must be inside the project directory", s.Go)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, pkg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("Go package %q does not exist in the project", s.Go)
+		}
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("Go package %q is not a directory", s.Go)
+	}
+
+	return nil
+}
+
+// resolvePath validates a script file and infers its type. A script with a
+// shebang line, or a compiled binary, is run directly as an "external" script.
+// Alfred can't run one without a shebang line directly, so it is run by the
+// interpreter of its type, inferred from its file extension. Whether the
+// script is executable doesn't matter, since it is packed with its executable
+// bit set.
+func (s *ScriptConfig) resolvePath(dir string) error {
+	path := filepath.Clean(s.Path)
+	if !insideProject(path) {
+		return fmt.Errorf("Script %q must be inside the project directory", s.Path)
+	}
+
+	file, err := os.Open(filepath.Join(dir, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("Script %q does not exist in the project", s.Path)
+		}
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("Script %q is not a regular file", s.Path)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+
+	shebang := bytes.HasPrefix(head, []byte("#!"))
+	if isMachO(head) || shebang {
+		if s.Type == "" {
+			s.Type = "external"
+		}
+		if shebang {
+			s.Language = shebangType(string(head))
+			if s.Language == "" {
+				s.Language = extensionTypes[filepath.Ext(path)]
+			}
+		}
+		return nil
+	}
+
+	if s.Type == "" {
+		s.Type = extensionTypes[filepath.Ext(path)]
+	}
+	switch s.Type {
+	case "":
+		return fmt.Errorf("Unable to infer the type of script %q, add a shebang line, a known file extension, or \"type\"", s.Path)
+	case "external":
+		return fmt.Errorf("Script %q must start with a shebang line to be run as an external script", s.Path)
+	}
+	s.Language = s.Type
+
+	return nil
+}
+
+// shebangType returns the script type of the interpreter named in the shebang
+// line of content, or an empty string if it is unknown.
+func shebangType(content string) string {
+	line, err := bufio.NewReader(strings.NewReader(content)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return ""
+	}
+
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter, args := filepath.Base(fields[0]), fields[1:]
+	if interpreter == "env" {
+		for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			return ""
+		}
+		interpreter, args = filepath.Base(args[0]), args[1:]
+	}
+
+	if interpreter == "osascript" {
+		for i, arg := range args {
+			if arg == "-l" && i+1 < len(args) && args[i+1] == "JavaScript" {
+				return "osascript-js"
+			}
+		}
+		return "osascript-as"
+	}
+
+	return interpreterTypes[interpreter]
+}
+
+// insideProject returns whether a cleaned path is relative to and inside the
+// project directory.
+func insideProject(path string) bool {
+	return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+}
+
+func isMachO(head []byte) bool {
+	for _, magic := range machOMagics {
+		if bytes.HasPrefix(head, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+func scriptTypeNames() []string {
+	names := make([]string, 0, len(scriptType))
+	for name := range scriptType {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
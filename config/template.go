@@ -0,0 +1,247 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template is a reusable set of objects that can be instantiated with the
+// "use" object form.
+type Template struct {
+	// Params maps parameter names to default values. A parameter without a
+	// default value is required.
+	Params  map[string]yaml.Node `yaml:"params"`
+	Objects yaml.Node            `yaml:"objects"`
+}
+
+// TemplateMap is a mapping of template names to templates
+type TemplateMap map[string]Template
+
+var templateParamPattern = regexp.MustCompile(`\$\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// expandTemplates replaces every "use" object in the root mapping node of a
+// config document with the objects of the template it names.
+func expandTemplates(root *yaml.Node, templates TemplateMap) error {
+	objects := mappingValue(root, "objects")
+	if objects == nil || objects.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	expanded := make([]*yaml.Node, 0, len(objects.Content))
+	for i := 0; i+1 < len(objects.Content); i += 2 {
+		key, value := objects.Content[i], objects.Content[i+1]
+
+		use := mappingValue(value, "use")
+		if use == nil {
+			expanded = append(expanded, key, value)
+			continue
+		}
+
+		nodes, err := instantiateTemplate(templates, key, value, use)
+		if err != nil {
+			return err
+		}
+		expanded = append(expanded, nodes...)
+	}
+
+	objects.Content = expanded
+
+	return nil
+}
+
+// instantiateTemplate returns the key and value nodes of the objects created
+// by instantiating a template at the given site.
+func instantiateTemplate(templates TemplateMap, siteKey *yaml.Node, site *yaml.Node, use *yaml.Node) ([]*yaml.Node, error) {
+	name := siteKey.Value
+	siteErr := func(format string, args ...interface{}) error {
+		msg := fmt.Sprintf(format, args...)
+		return fmt.Errorf("line %d: object %q: %s", siteKey.Line, name, msg)
+	}
+
+	tmpl, ok := templates[use.Value]
+	if !ok {
+		return nil, siteErr("unknown template %q", use.Value)
+	}
+
+	for i := 0; i+1 < len(site.Content); i += 2 {
+		if key := site.Content[i].Value; key != "use" && key != "with" {
+			return nil, siteErr("unexpected key %q in template instantiation", key)
+		}
+	}
+
+	args := make(map[string]*yaml.Node)
+	if with := mappingValue(site, "with"); with != nil {
+		if with.Kind != yaml.MappingNode {
+			return nil, siteErr("\"with\" must be a map of template parameters")
+		}
+
+		for i := 0; i+1 < len(with.Content); i += 2 {
+			param := with.Content[i].Value
+			if _, ok := tmpl.Params[param]; !ok {
+				return nil, siteErr("unknown parameter %q for template %q", param, use.Value)
+			}
+			args[param] = with.Content[i+1]
+		}
+	}
+
+	for param, def := range tmpl.Params {
+		if _, ok := args[param]; ok {
+			continue
+		}
+
+		if def.ShortTag() == "!!null" {
+			return nil, siteErr("missing required parameter %q for template %q", param, use.Value)
+		}
+
+		args[param] = copyNode(&def)
+	}
+
+	if tmpl.Objects.Kind != yaml.MappingNode {
+		return nil, siteErr("template %q has no objects", use.Value)
+	}
+
+	local := make(map[string]bool)
+	for i := 0; i < len(tmpl.Objects.Content); i += 2 {
+		local[tmpl.Objects.Content[i].Value] = true
+	}
+
+	prefix := func(objName string) string {
+		return fmt.Sprintf("%s.%s", name, objName)
+	}
+
+	nodes := make([]*yaml.Node, 0, len(tmpl.Objects.Content))
+	for i := 0; i+1 < len(tmpl.Objects.Content); i += 2 {
+		key := copyNode(tmpl.Objects.Content[i])
+		key.Value = prefix(key.Value)
+
+		value, err := substituteParams(tmpl.Objects.Content[i+1], args)
+		if err != nil {
+			return nil, siteErr("%s", err)
+		}
+
+		if then := mappingValue(value, "then"); then != nil {
+			for _, target := range thenTargets(then) {
+				if local[target.Value] {
+					target.Value = prefix(target.Value)
+				}
+			}
+		}
+
+		// Report errors in expanded objects against the instantiation site.
+		setLine(key, siteKey.Line)
+		setLine(value, siteKey.Line)
+
+		nodes = append(nodes, key, value)
+	}
+
+	return nodes, nil
+}
+
+// substituteParams returns a copy of node with all template parameter
+// references replaced by their arguments. A scalar consisting solely of a
+// reference is replaced by the argument node itself, so that non-string
+// arguments keep their type.
+func substituteParams(node *yaml.Node, args map[string]*yaml.Node) (*yaml.Node, error) {
+	if node.Kind == yaml.ScalarNode {
+		if m := templateParamPattern.FindStringSubmatch(node.Value); m != nil && m[0] == strings.TrimSpace(node.Value) {
+			arg, ok := args[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("reference to undeclared parameter %q", m[1])
+			}
+			return copyNode(arg), nil
+		}
+
+		var err error
+		cp := copyNode(node)
+		cp.Value = templateParamPattern.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			param := templateParamPattern.FindStringSubmatch(ref)[1]
+			arg, ok := args[param]
+			if !ok {
+				err = fmt.Errorf("reference to undeclared parameter %q", param)
+				return ref
+			}
+			if arg.Kind != yaml.ScalarNode {
+				err = fmt.Errorf("parameter %q must be a string to be used inside %q", param, node.Value)
+				return ref
+			}
+			return arg.Value
+		})
+
+		return cp, err
+	}
+
+	cp := copyNode(node)
+	cp.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		sub, err := substituteParams(child, args)
+		if err != nil {
+			return nil, err
+		}
+		cp.Content[i] = sub
+	}
+
+	return cp, nil
+}
+
+// thenTargets returns the scalar nodes naming objects in a "then" node.
+func thenTargets(then *yaml.Node) []*yaml.Node {
+	switch then.Kind {
+	case yaml.ScalarNode:
+		return []*yaml.Node{then}
+	case yaml.MappingNode:
+		if obj := mappingValue(then, "object"); obj != nil {
+			return []*yaml.Node{obj}
+		}
+	case yaml.SequenceNode:
+		var targets []*yaml.Node
+		for _, item := range then.Content {
+			targets = append(targets, thenTargets(item)...)
+		}
+		return targets
+	}
+
+	return nil
+}
+
+// mappingValue returns the value node for a key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// copyNode returns a deep copy of a node.
+func copyNode(node *yaml.Node) *yaml.Node {
+	cp := *node
+	cp.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		cp.Content[i] = copyNode(child)
+	}
+	return &cp
+}
+
+func setLine(node *yaml.Node, line int) {
+	node.Line = line
+	for _, child := range node.Content {
+		setLine(child, line)
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultTestTimeout is how long a test may run if it has no timeout.
+const DefaultTestTimeout = 10 * time.Second
+
+// Test is a test case of a workflow, run by "alpaca test". It runs the
+// workflow from a trigger, as "alpaca run" does, and checks the result.
+type Test struct {
+	Name      string            `yaml:"name,omitempty"`
+	Trigger   string            `yaml:"trigger"`
+	Query     string            `yaml:"query,omitempty"`
+	Variables map[string]string `yaml:"variables,omitempty"`
+
+	// Item is the number of the script filter item to action. The first valid
+	// item is actioned if it is 0.
+	Item int `yaml:"item,omitempty"`
+
+	// Mod is the combination of modifier keys held when actioning a script
+	// filter item, joined by "+".
+	Mod string `yaml:"mod,omitempty"`
+
+	Timeout string `yaml:"timeout,omitempty"`
+
+	// Recording is the path of a recording of the scripts the test invokes,
+	// relative to the project. The recorded outputs are served instead of
+	// running the scripts, and an invocation that doesn't match its
+	// recording fails the test.
+	Recording string `yaml:"recording,omitempty"`
+
+	Expect Expectations `yaml:"expect,omitempty"`
+
+	// Source is the path of the file the test is defined in.
+	Source string `yaml:"-"`
+}
+
+// Expectations are what a test checks about the result of a workflow run.
+// Only the expectations given are checked.
+type Expectations struct {
+	// Items are the items expected from the first script filter run, in
+	// order.
+	Items []ExpectedItem `yaml:"items,omitempty"`
+
+	// Clipboard is the text expected to be copied to the clipboard last.
+	Clipboard *string `yaml:"clipboard,omitempty"`
+
+	// URLs are the URLs expected to be opened, in order.
+	URLs []string `yaml:"urls,omitempty"`
+
+	// Variables are the values that variables are expected to be set to.
+	Variables map[string]string `yaml:"variables,omitempty"`
+
+	// Commands are the invocations of the sandbox's stubs expected, in
+	// order.
+	Commands []ExpectedCommand `yaml:"commands,omitempty"`
+}
+
+// ExpectedCommand is an invocation of a sandbox's stub expected by a test.
+// Only the fields given are checked.
+type ExpectedCommand struct {
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args,omitempty"`
+	Stdin   *string  `yaml:"stdin,omitempty"`
+}
+
+// ExpectedItem is a script filter item expected by a test. Only the fields
+// given are checked.
+type ExpectedItem struct {
+	Title    *string `yaml:"title,omitempty"`
+	Subtitle *string `yaml:"subtitle,omitempty"`
+	Arg      *string `yaml:"arg,omitempty"`
+	Valid    *bool   `yaml:"valid,omitempty"`
+}
+
+// UnmarshalYAML unmarshals a test, validating its trigger, modifier keys, and
+// timeout.
+func (t *Test) UnmarshalYAML(node *yaml.Node) error {
+	type alias Test
+	var as alias
+	if err := node.Decode(&as); err != nil {
+		return err
+	}
+
+	if as.Trigger == "" {
+		return fmt.Errorf("line %d: Test has no trigger", node.Line)
+	}
+
+	if _, err := ModifierMask(as.Mod); err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+
+	if as.Timeout != "" {
+		if _, err := time.ParseDuration(as.Timeout); err != nil {
+			return fmt.Errorf("line %d: Invalid timeout %q", node.Line, as.Timeout)
+		}
+	}
+
+	*t = Test(as)
+
+	return nil
+}
+
+// Duration returns how long the test may run.
+func (t Test) Duration() time.Duration {
+	d, err := time.ParseDuration(t.Timeout)
+	if err != nil || d <= 0 {
+		return DefaultTestTimeout
+	}
+	return d
+}
+
+// Title returns the name of the test, or else its trigger and query.
+func (t Test) Title() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	if t.Query == "" {
+		return t.Trigger
+	}
+	return t.Trigger + " " + t.Query
+}
@@ -0,0 +1,163 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jclem/alpaca/config"
+)
+
+// WorkflowOutput is the JSON object a script can print, under the key
+// "alfredworkflow", to set the argument and variables passed on to the
+// objects it connects to, and to override their config.
+type WorkflowOutput struct {
+	Arg       Arg                    `json:"arg"`
+	Variables map[string]string      `json:"variables"`
+	Config    map[string]interface{} `json:"config"`
+}
+
+// ParseWorkflowOutput parses the output of a script as an alfredworkflow
+// object. It returns nil if the output isn't one. Output that looks like one
+// but is malformed is returned as an error; Alfred passes it on as text.
+func ParseWorkflowOutput(output string) (*WorkflowOutput, error) {
+	trimmed := strings.TrimSpace(output)
+	if !strings.HasPrefix(trimmed, "{") || !strings.Contains(trimmed, `"alfredworkflow"`) {
+		return nil, nil
+	}
+
+	data := []byte(trimmed)
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line, col := position(data, syntaxErr.Offset)
+			return nil, fmt.Errorf("Invalid alfredworkflow output: %s at line %d, column %d", err, line, col)
+		}
+		return nil, fmt.Errorf("Invalid alfredworkflow output: %s", err)
+	}
+
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := obj["alfredworkflow"]; !ok {
+		return nil, nil
+	}
+
+	v := &validator{}
+	v.object("", value, map[string]func(string, interface{}){
+		"alfredworkflow": func(path string, value interface{}) {
+			v.object(path, value, map[string]func(string, interface{}){
+				"arg":       v.arg,
+				"variables": v.variables,
+				"config":    v.config,
+			})
+		},
+	})
+	if len(v.problems) > 0 {
+		return nil, fmt.Errorf("Invalid alfredworkflow output:\n  %s", strings.Join(v.problems, "\n  "))
+	}
+
+	var parsed struct {
+		AlfredWorkflow WorkflowOutput `json:"alfredworkflow"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("Invalid alfredworkflow output: %s", err)
+	}
+
+	return &parsed.AlfredWorkflow, nil
+}
+
+func (v *validator) config(path string, value interface{}) {
+	if _, ok := value.(map[string]interface{}); !ok {
+		v.add(path, "must be an object, got %s", typeName(value))
+	}
+}
+
+// configKeys are the keys of the config of each type of object, as Alfred
+// names them, that an alfredworkflow object can override, and the fields
+// they set.
+var configKeys = map[config.ObjectType]map[string]func(obj *config.Object, value string){
+	config.ClipboardType: {
+		"clipboardtext": func(obj *config.Object, value string) {
+			cfg := obj.Config.(config.Clipboard)
+			cfg.Text = value
+			obj.Config = cfg
+		},
+	},
+	config.OpenURLType: {
+		"url": func(obj *config.Object, value string) {
+			cfg := obj.Config.(config.OpenURL)
+			cfg.URL = value
+			obj.Config = cfg
+		},
+	},
+	config.NotificationType: {
+		"title": func(obj *config.Object, value string) {
+			cfg := obj.Config.(config.Notification)
+			cfg.Title = value
+			obj.Config = cfg
+		},
+		"text": func(obj *config.Object, value string) {
+			cfg := obj.Config.(config.Notification)
+			cfg.Text = value
+			obj.Config = cfg
+		},
+	},
+	config.ScriptType: {
+		"script": func(obj *config.Object, value string) {
+			cfg := obj.Config.(config.Script)
+			cfg.Script = inlineScript(cfg.Script, value)
+			obj.Config = cfg
+		},
+	},
+	config.AppleScriptType: {
+		"applescript": func(obj *config.Object, value string) {
+			cfg := obj.Config.(config.AppleScript)
+			cfg.Content = value
+			obj.Config = cfg
+		},
+	},
+}
+
+// inlineScript returns a script with the given content in place of the
+// content or file of script.
+func inlineScript(script config.ScriptConfig, content string) config.ScriptConfig {
+	script.Content = content
+	script.Path = ""
+	script.Go = ""
+	if script.Type == "" {
+		script.Type = "bash"
+	}
+	return script
+}
+
+// overrideConfig returns the object with its config overridden by the config
+// of an alfredworkflow object. Keys that aren't emulated are returned, to be
+// reported.
+func overrideConfig(obj config.Object, overrides map[string]interface{}) (config.Object, []string, error) {
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var ignored []string
+	for _, key := range keys {
+		set, ok := configKeys[obj.Type][key]
+		if !ok {
+			ignored = append(ignored, key)
+			continue
+		}
+
+		value, ok := overrides[key].(string)
+		if !ok {
+			return obj, nil, fmt.Errorf("The config key %q set by alfredworkflow output must be a string, got %s", key, typeName(overrides[key]))
+		}
+		set(&obj, value)
+	}
+
+	return obj, ignored, nil
+}
@@ -0,0 +1,472 @@
+// Package emulator runs Alpaca workflows locally, emulating Alfred.
+package emulator
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/pkg/errors"
+)
+
+// errNotRunnable is returned for objects that can not run on this machine.
+var errNotRunnable = errors.New("Not runnable on this machine")
+
+// errTimeout is returned for scripts killed because a run timed out.
+var errTimeout = errors.New("Script timed out")
+
+// Runner runs the objects of a workflow, starting from a trigger and
+// following their connections. Outputs such as copying to the clipboard or
+// opening a URL are recorded instead of performed.
+type Runner struct {
+	// Dir is the project directory, which scripts run in.
+	Dir string
+
+	Config *config.Config
+
+	// Variables override the values of the workflow's variables.
+	Variables map[string]string
+
+	// Choose chooses the item of a script filter's output to action. If it is
+	// nil, the first valid item is actioned without modifier keys.
+	Choose Chooser
+
+	// Sandboxed is whether every run has a new sandbox that scripts run in.
+	Sandboxed bool
+
+	// Recording is the recording of the scripts invoked by a run. Scripts
+	// are recorded into it, or replayed from it instead of running, as set
+	// by RecordMode. Scripts are run as usual if it is nil.
+	Recording  *Recording
+	RecordMode RecordMode
+
+	ctx     context.Context
+	sandbox *Sandbox
+}
+
+// Selection is an item of a script filter's output chosen to be actioned,
+// and the modifier keys held while doing so.
+type Selection struct {
+	// Item is the index of the item.
+	Item int
+
+	// Mod is the combination of modifier keys held, joined by "+", if any.
+	Mod string
+}
+
+// Chooser chooses the item of a script filter's output to action. It returns
+// false if no item should be actioned.
+type Chooser func(object string, output *ScriptFilterOutput) (Selection, bool, error)
+
+// FirstValid chooses the first valid item of a script filter's output,
+// without modifier keys.
+func FirstValid(object string, output *ScriptFilterOutput) (Selection, bool, error) {
+	for i, item := range output.Items {
+		if item.IsValid() {
+			return Selection{Item: i}, true, nil
+		}
+	}
+	return Selection{}, false, nil
+}
+
+// New returns a runner for the workflow of the project in dir with the given
+// config.
+func New(dir string, cfg *config.Config) *Runner {
+	return &Runner{Dir: dir, Config: cfg}
+}
+
+// Step is an object visited while running a workflow.
+type Step struct {
+	// Depth is the number of connections followed to reach the object.
+	Depth int
+
+	Object string
+	Type   config.ObjectType
+
+	// Query is the input of the object.
+	Query string
+
+	// Note describes what the object did, if anything noteworthy.
+	Note string
+
+	// Output is the output of a script filter.
+	Output *ScriptFilterOutput
+
+	// Warnings describe what the object did that Alfred would do
+	// differently than intended, or that isn't emulated.
+	Warnings []string
+}
+
+// Output is an output of a workflow that was recorded instead of performed.
+type Output struct {
+	Object string
+	Type   config.ObjectType
+
+	// Title is the title of a notification.
+	Title string
+
+	// Value is the text copied to the clipboard, the URL opened, or the text
+	// of a notification.
+	Value string
+}
+
+func (o Output) String() string {
+	switch o.Type {
+	case config.ClipboardType:
+		return fmt.Sprintf("Copy to clipboard: %q", o.Value)
+	case config.OpenURLType:
+		return fmt.Sprintf("Open URL: %s", o.Value)
+	case config.NotificationType:
+		return fmt.Sprintf("Post notification: %q %q", o.Title, o.Value)
+	}
+	return fmt.Sprintf("%s: %q", o.Type, o.Value)
+}
+
+// Result is the record of a workflow run.
+type Result struct {
+	Trace   []Step
+	Outputs []Output
+
+	// Variables are the values variables were set to during the run. A
+	// variable set more than once has the value set last.
+	Variables map[string]string
+
+	// Invocations are the invocations of the stubs of a sandboxed run.
+	Invocations []Invocation
+}
+
+// FindTrigger returns the name of the object that a trigger refers to: the
+// input object with the trigger as its keyword, or else the object named by
+// it.
+func (r *Runner) FindTrigger(trigger string) (string, error) {
+	for _, name := range r.objectNames() {
+		if r.Config.Objects[name].Keyword() == trigger {
+			return name, nil
+		}
+	}
+
+	if _, ok := r.Config.Objects[trigger]; ok {
+		return trigger, nil
+	}
+
+	return "", fmt.Errorf("No object has the keyword or name %q", trigger)
+}
+
+// Run runs the workflow from the object with the given trigger, with query
+// as its input.
+func (r *Runner) Run(trigger string, query string) (*Result, error) {
+	return r.RunContext(context.Background(), trigger, query)
+}
+
+// RunContext runs the workflow like Run, killing any script still running
+// when ctx is done.
+func (r *Runner) RunContext(ctx context.Context, trigger string, query string) (*Result, error) {
+	name, err := r.FindTrigger(trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	for _, set := range []map[string]string{r.Config.Variables, r.Variables} {
+		for k, v := range set {
+			vars[k] = v
+		}
+	}
+
+	run := *r
+	run.ctx = ctx
+
+	if r.Sandboxed {
+		sandbox, err := NewSandbox(r.Dir, r.Config.BundleID)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create sandbox: %s", err)
+		}
+		defer sandbox.Close()
+		run.sandbox = sandbox
+	}
+
+	result := &Result{Variables: make(map[string]string)}
+	err = run.visit(result, name, query, vars, nil, 0)
+
+	if run.sandbox != nil {
+		invocations, logErr := run.sandbox.Invocations()
+		if logErr != nil && err == nil {
+			err = logErr
+		}
+		result.Invocations = invocations
+	}
+
+	if r.Recording != nil && r.RecordMode == Replay && err == nil {
+		err = r.Recording.unreplayed()
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// action is what an object passes on to the objects connected to it.
+type action struct {
+	query string
+
+	// mod is the combination of modifier keys held, which selects the
+	// connections followed.
+	mod string
+
+	vars map[string]string
+
+	// config overrides the config of the objects connected to, with keys
+	// named as in Alfred.
+	config map[string]interface{}
+}
+
+// visit runs the named object with the given input and config overrides,
+// then every object it is connected to with its output.
+func (r *Runner) visit(result *Result, name string, query string, vars map[string]string, overrides map[string]interface{}, depth int) error {
+	obj, ok := r.Config.Objects[name]
+	if !ok {
+		return fmt.Errorf("Could not find object %q", name)
+	}
+
+	for k, v := range vars {
+		result.Variables[k] = v
+	}
+
+	step := Step{Depth: depth, Object: name, Type: obj.Type, Query: query}
+
+	obj, ignored, err := overrideConfig(obj, overrides)
+	if err != nil {
+		result.Trace = append(result.Trace, step)
+		return fmt.Errorf("Object %q: %s", name, err)
+	}
+	for _, key := range ignored {
+		step.Warnings = append(step.Warnings, fmt.Sprintf("overriding the config key %q is not emulated", key))
+	}
+
+	next, err := r.run(result, obj, &step, query, vars)
+	result.Trace = append(result.Trace, step)
+	if err != nil {
+		return fmt.Errorf("Object %q: %s", name, err)
+	}
+
+	if next == nil {
+		return nil
+	}
+
+	mask, err := config.ModifierMask(next.mod)
+	if err != nil {
+		return fmt.Errorf("Object %q: %s", name, err)
+	}
+
+	for _, then := range obj.Then {
+		// Modifiers are validated when the config is read.
+		if thenMask, _ := config.ModifierMask(then.Mod); thenMask != mask {
+			continue
+		}
+
+		if err := r.visit(result, then.Object, next.query, next.vars, next.config, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run runs a single object, returning what it passes on to the objects it is
+// connected to, or nil if it doesn't continue.
+func (r *Runner) run(result *Result, obj config.Object, step *Step, query string, vars map[string]string) (*action, error) {
+	noEscape := func(s string) string { return s }
+	pass := func(query string) *action { return &action{query: query, vars: vars} }
+
+	switch cfg := obj.Config.(type) {
+	case config.Keyword:
+		return pass(query), nil
+
+	case config.Script:
+		res, err := r.runScript(obj.Name, cfg.Script, query, vars, nil)
+		if err != nil {
+			return nil, err
+		}
+		return r.scriptOutput(res.stdout, step, vars), nil
+
+	case config.ScriptFilter:
+		res, err := r.runScript(obj.Name, cfg.Script, query, vars, cfg.Escaping)
+		if err != nil {
+			return nil, err
+		}
+
+		output, err := ParseScriptFilterOutput([]byte(res.stdout))
+		if err != nil {
+			return nil, err
+		}
+		step.Output = output
+
+		return r.choose(obj.Name, output, step, vars)
+
+	case config.ListFilter:
+		for _, item := range cfg.Items {
+			if strings.Contains(strings.ToLower(item.Title), strings.ToLower(query)) {
+				step.Note = fmt.Sprintf("chose item %q", item.Title)
+				return pass(item.Arg), nil
+			}
+		}
+		step.Note = "no matching items"
+		return nil, nil
+
+	case config.AppleScript:
+		if _, err := r.runAppleScript(obj.Name, cfg, query, vars); err != nil {
+			if err == errNotRunnable {
+				step.Note = "not run, osascript is not available"
+				return pass(query), nil
+			}
+			return nil, err
+		}
+		return pass(query), nil
+
+	case config.Clipboard:
+		text := substitute(cfg.Text, query, vars, noEscape)
+		result.Outputs = append(result.Outputs, Output{Object: obj.Name, Type: obj.Type, Value: text})
+		return pass(query), nil
+
+	case config.OpenURL:
+		u := substitute(cfg.URL, query, vars, func(s string) string {
+			return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+		})
+		result.Outputs = append(result.Outputs, Output{Object: obj.Name, Type: obj.Type, Value: u})
+		return pass(query), nil
+
+	case config.Notification:
+		result.Outputs = append(result.Outputs, Output{
+			Object: obj.Name,
+			Type:   obj.Type,
+			Title:  substitute(cfg.Title, query, vars, noEscape),
+			Value:  substitute(cfg.Text, query, vars, noEscape),
+		})
+		return pass(query), nil
+	}
+
+	return nil, fmt.Errorf("Unable to run objects of type %q", obj.Type)
+}
+
+// scriptOutput returns what a script passes on: the argument, variables, and
+// config of its output if it is an alfredworkflow object, or else its output
+// as text. Variables set are added to those the script ran with.
+func (r *Runner) scriptOutput(stdout string, step *Step, vars map[string]string) *action {
+	output, err := ParseWorkflowOutput(stdout)
+	if err != nil {
+		step.Warnings = append(step.Warnings, fmt.Sprintf("%s; Alfred passes it on as text", err))
+	}
+	if output == nil {
+		step.Note = fmt.Sprintf("output %q", stdout)
+		return &action{query: stdout, vars: vars}
+	}
+
+	next := make(map[string]string)
+	for _, set := range []map[string]string{vars, output.Variables} {
+		for k, v := range set {
+			next[k] = v
+		}
+	}
+
+	step.Note = fmt.Sprintf("output alfredworkflow with arg %q", output.Arg.String())
+	if len(output.Variables) > 0 {
+		keys := make([]string, 0, len(output.Variables))
+		for key := range output.Variables {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		step.Note += ", variables " + strings.Join(keys, ", ")
+	}
+	if len(output.Config) > 0 {
+		keys := make([]string, 0, len(output.Config))
+		for key := range output.Config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		step.Note += ", config " + strings.Join(keys, ", ")
+	}
+
+	return &action{query: output.Arg.String(), vars: next, config: output.Config}
+}
+
+// choose actions the item of a script filter's output chosen by the runner's
+// chooser. The item's argument is passed on, with the output's variables and
+// the item's, or the modifier's if it has its own.
+func (r *Runner) choose(name string, output *ScriptFilterOutput, step *Step, vars map[string]string) (*action, error) {
+	choose := r.Choose
+	if choose == nil {
+		choose = FirstValid
+	}
+
+	sel, ok, err := choose(name, output)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		step.Note = "no item chosen"
+		if len(output.Items) == 0 {
+			step.Note = "no items"
+		}
+		return nil, nil
+	}
+
+	if sel.Item < 0 || sel.Item >= len(output.Items) {
+		return nil, fmt.Errorf("There is no item %d, the output has %d items", sel.Item+1, len(output.Items))
+	}
+
+	item := output.Items[sel.Item]
+	arg, valid, itemVars := item.Arg, item.IsValid(), item.Variables
+
+	if sel.Mod != "" {
+		if _, err := config.ModifierMask(sel.Mod); err != nil {
+			return nil, err
+		}
+
+		if mod, ok := item.Mod(sel.Mod); ok {
+			if mod.Valid != nil {
+				valid = *mod.Valid
+			}
+			if mod.Arg != nil {
+				arg = mod.Arg
+			}
+			if mod.Variables != nil {
+				itemVars = mod.Variables
+			}
+		}
+	}
+
+	if !valid {
+		if sel.Mod != "" {
+			return nil, fmt.Errorf("Item %d %q is not valid with %s", sel.Item+1, item.Title, sel.Mod)
+		}
+		return nil, fmt.Errorf("Item %d %q is not valid", sel.Item+1, item.Title)
+	}
+
+	next := make(map[string]string)
+	for _, set := range []map[string]string{vars, output.Variables, itemVars} {
+		for k, v := range set {
+			next[k] = v
+		}
+	}
+
+	step.Note = fmt.Sprintf("chose item %d %q with arg %q", sel.Item+1, item.Title, arg.String())
+	if sel.Mod != "" {
+		step.Note += " holding " + sel.Mod
+	}
+
+	return &action{query: arg.String(), mod: sel.Mod, vars: next}, nil
+}
+
+func (r *Runner) objectNames() []string {
+	names := make([]string, 0, len(r.Config.Objects))
+	for name := range r.Config.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
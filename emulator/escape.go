@@ -0,0 +1,64 @@
+package emulator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// escapes are the characters escaped by each of Alfred's escaping options,
+// named as in config.ScriptFilter.Escaping. Backslashes are escaped first, so
+// that the backslashes of other escapes aren't escaped again.
+var escapes = []struct {
+	option string
+	chars  string
+}{
+	{"backslashes", `\`},
+	{"spaces", " "},
+	{"backquotes", "`"},
+	{"double-quote", `"`},
+	{"brackets", "()[]{}"},
+	{"semicolons", ";"},
+	{"dollars", "$"},
+}
+
+// escape escapes s with a backslash before every character selected by the
+// given escaping options, as Alfred does before substituting a query into a
+// script.
+func escape(s string, options []string) string {
+	enabled := make(map[string]bool)
+	for _, option := range options {
+		enabled[option] = true
+	}
+
+	for _, e := range escapes {
+		if !enabled[e.option] {
+			continue
+		}
+
+		var b strings.Builder
+		for _, r := range s {
+			if strings.ContainsRune(e.chars, r) {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+		s = b.String()
+	}
+
+	return s
+}
+
+var placeholder = regexp.MustCompile(`\{query\}|\{var:([^}]+)\}`)
+
+// substitute replaces "{query}" in s with the query and "{var:NAME}" with the
+// value of the variable NAME, or an empty string if it isn't set. Replaced
+// values are passed through quote first.
+func substitute(s string, query string, vars map[string]string, quote func(string) string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "{query}" {
+			return quote(query)
+		}
+		name := placeholder.FindStringSubmatch(match)[1]
+		return quote(vars[name])
+	})
+}
@@ -0,0 +1,77 @@
+package emulator
+
+import (
+	"strings"
+	"unicode"
+)
+
+// FilterItems returns the items matching query in the given match mode of
+// alfred-filters-results, as Alfred filters a script filter's output. Items
+// are matched by their match field, or else by their title. Every item
+// matches an empty query.
+func FilterItems(items []Item, query string, mode string) []Item {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return items
+	}
+
+	var matched []Item
+	for _, item := range items {
+		text := item.Match
+		if text == "" {
+			text = item.Title
+		}
+
+		if matches(strings.ToLower(text), query, mode) {
+			matched = append(matched, item)
+		}
+	}
+
+	return matched
+}
+
+// matches returns whether the lowercase text matches the lowercase query in
+// the given match mode:
+//
+// - exact-start: the text starts with the query
+// - word-match: every word of the query starts a word of the text
+// - exact-boundary (the default): the query starts at a word of the text
+func matches(text string, query string, mode string) bool {
+	switch mode {
+	case "exact-start":
+		return strings.HasPrefix(text, query)
+
+	case "word-match":
+		words := strings.FieldsFunc(text, isSeparator)
+		for _, q := range strings.FieldsFunc(query, isSeparator) {
+			found := false
+			for _, word := range words {
+				if strings.HasPrefix(word, q) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i+len(query) <= len(text); i++ {
+		if !strings.HasPrefix(text[i:], query) {
+			continue
+		}
+		if i == 0 {
+			return true
+		}
+		if r := rune(text[i-1]); r < 0x80 && isSeparator(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
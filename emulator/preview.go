@@ -0,0 +1,305 @@
+package emulator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jclem/alpaca/config"
+)
+
+// automaticDelay approximates the delay of the "automatic" queue delay, which
+// Alfred adapts to the user's typing speed.
+const automaticDelay = 250 * time.Millisecond
+
+// PreviewResult is the result of running a script filter for a query in a
+// preview.
+type PreviewResult struct {
+	Query string
+
+	// Output is the output of the script filter, which is nil if it failed.
+	Output *ScriptFilterOutput
+
+	// Items are the items to show for the query, filtered by Alfred's
+	// matching if the script filter uses alfred-filters-results.
+	Items []Item
+
+	// Err is the reason the script filter failed, if it did.
+	Err error
+
+	Duration time.Duration
+}
+
+// Preview re-runs a script filter as its query changes, following the queue
+// mode, queue delay, and immediate first character of its run-behavior, as
+// Alfred does. A script filter that uses alfred-filters-results is run only
+// once, and its items are filtered locally for every query.
+type Preview struct {
+	runner  *Runner
+	name    string
+	filter  config.ScriptFilter
+	sandbox *Sandbox
+
+	queries chan string
+	results chan PreviewResult
+	done    chan struct{}
+
+	// stopped is closed once the preview has stopped its scripts and
+	// removed its sandbox.
+	stopped chan struct{}
+}
+
+// Preview starts a preview of the named script filter. Results are sent on the
+// channel returned by Results until the preview is closed. Only the latest
+// result is kept until it is received.
+func (r *Runner) Preview(name string) (*Preview, error) {
+	obj, ok := r.Config.Objects[name]
+	if !ok {
+		return nil, fmt.Errorf("Could not find object %q", name)
+	}
+
+	filter, ok := obj.Config.(config.ScriptFilter)
+	if !ok {
+		return nil, fmt.Errorf("Object %q is a %s, not a script filter", name, obj.Type)
+	}
+
+	var sandbox *Sandbox
+	if r.Sandboxed {
+		var err error
+		if sandbox, err = NewSandbox(r.Dir, r.Config.BundleID); err != nil {
+			return nil, fmt.Errorf("Unable to create sandbox: %s", err)
+		}
+	}
+
+	p := &Preview{
+		runner:  r,
+		name:    name,
+		sandbox: sandbox,
+		filter:  filter,
+		queries: make(chan string),
+		results: make(chan PreviewResult, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.loop()
+
+	return p, nil
+}
+
+// SetQuery changes the query of the preview.
+func (p *Preview) SetQuery(query string) {
+	select {
+	case p.queries <- query:
+	case <-p.done:
+	}
+}
+
+// Results returns the channel that results are sent on.
+func (p *Preview) Results() <-chan PreviewResult {
+	return p.results
+}
+
+// Close stops the preview, killing the script filter if it is running and
+// removing its sandbox. It returns once they are gone.
+func (p *Preview) Close() {
+	close(p.done)
+	<-p.stopped
+}
+
+// delay returns how long to wait after a query changes before running the
+// script filter for it.
+func (p *Preview) delay(previous string, query string) time.Duration {
+	behavior := p.filter.RunBehavior
+	if behavior == nil {
+		return 0
+	}
+
+	if behavior.Immediate && previous == "" && len([]rune(query)) == 1 {
+		return 0
+	}
+
+	switch behavior.QueueDelay {
+	case "", "immediate":
+		return 0
+	case "automatic":
+		return automaticDelay
+	}
+
+	d, err := time.ParseDuration(behavior.QueueDelay)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// terminates returns whether a run is terminated when a new one is due,
+// instead of waiting for it to complete.
+func (p *Preview) terminates() bool {
+	return p.filter.RunBehavior != nil && p.filter.RunBehavior.QueueMode == "terminate"
+}
+
+// filters returns whether Alfred filters the script filter's results.
+func (p *Preview) filters() bool {
+	return p.filter.AlfredFilters != nil
+}
+
+func (p *Preview) loop() {
+	defer close(p.stopped)
+
+	var (
+		query   string
+		due     bool
+		timer   <-chan time.Time
+		running context.CancelFunc
+		done    chan PreviewResult
+		// output is the output filtered locally with alfred-filters-results.
+		output *PreviewResult
+		// runs are the runs not yet finished, including terminated ones.
+		runs sync.WaitGroup
+	)
+
+	start := func(q string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		running = cancel
+		done = make(chan PreviewResult, 1)
+		runs.Add(1)
+		go func(done chan<- PreviewResult) {
+			defer runs.Done()
+			done <- p.run(ctx, q)
+		}(done)
+	}
+
+	// Results replace any result not yet received, so the loop never waits
+	// for them to be received.
+	send := func(result PreviewResult) {
+		select {
+		case <-p.results:
+		default:
+		}
+		p.results <- result
+	}
+
+	// Alfred runs a script filter whose results it filters once, with the
+	// query it was opened with.
+	if p.filters() {
+		start("")
+	} else {
+		due = true
+	}
+
+	for {
+		if due && done == nil && !p.filters() {
+			due = false
+			start(query)
+		}
+
+		select {
+		case q := <-p.queries:
+			previous := query
+			query = q
+
+			if p.filters() {
+				if output != nil {
+					send(p.filtered(*output, query))
+				}
+				continue
+			}
+
+			due = false
+			d := p.delay(previous, query)
+			if d == 0 {
+				timer = nil
+				due = true
+			} else {
+				timer = time.After(d)
+			}
+
+			if due && done != nil && p.terminates() {
+				running()
+				running, done = nil, nil
+			}
+
+		case <-timer:
+			timer = nil
+			due = true
+			if done != nil && p.terminates() {
+				running()
+				running, done = nil, nil
+			}
+
+		case result := <-done:
+			running()
+			running, done = nil, nil
+
+			if p.filters() {
+				output = &result
+				send(p.filtered(result, query))
+				continue
+			}
+
+			// Results of queries that are out of date are shown while the
+			// latest query waits to run, as Alfred does.
+			send(result)
+
+		case <-p.done:
+			if running != nil {
+				running()
+			}
+			runs.Wait()
+			if p.sandbox != nil {
+				p.sandbox.Close()
+			}
+			return
+		}
+	}
+}
+
+// filtered returns a result with the items of an output that match query.
+func (p *Preview) filtered(result PreviewResult, query string) PreviewResult {
+	result.Query = query
+	if result.Output != nil {
+		result.Items = FilterItems(result.Output.Items, query, p.filter.AlfredFilters.Mode)
+	}
+	return result
+}
+
+// run runs the script filter for a query.
+func (p *Preview) run(ctx context.Context, query string) PreviewResult {
+	start := time.Now()
+	result := PreviewResult{Query: query}
+
+	if p.filter.Argument == "required" && strings.TrimSpace(query) == "" {
+		result.Output = &ScriptFilterOutput{}
+		return result
+	}
+
+	runner := *p.runner
+	runner.ctx = ctx
+	runner.sandbox = p.sandbox
+
+	vars := make(map[string]string)
+	for _, set := range []map[string]string{p.runner.Config.Variables, p.runner.Variables} {
+		for k, v := range set {
+			vars[k] = v
+		}
+	}
+
+	res, err := runner.runScript(p.name, p.filter.Script, query, vars, p.filter.Escaping)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	output, err := ParseScriptFilterOutput([]byte(res.stdout))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Output = output
+	result.Items = output.Items
+	return result
+}
@@ -0,0 +1,184 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jclem/alpaca/textdiff"
+)
+
+// RecordMode is what a runner does with the recording of a run.
+type RecordMode int
+
+const (
+	// Replay serves the outputs of recorded invocations instead of running
+	// scripts.
+	Replay RecordMode = iota
+
+	// Record runs scripts and records their invocations.
+	Record
+)
+
+// ScriptRecord is a recorded invocation of a script, with what it printed
+// and its exit status.
+type ScriptRecord struct {
+	Object string `json:"object"`
+
+	// Args are the arguments of the script's command. A command in the
+	// project is relative to it, and one elsewhere is only its name.
+	Args []string `json:"args"`
+
+	// Env are the workflow variables the script ran with. Scripts have no
+	// standard input, as in Alfred.
+	Env map[string]string `json:"env"`
+
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitStatus int    `json:"exit_status"`
+}
+
+// scriptInput is what a script is invoked with, which is compared when it
+// is replayed.
+type scriptInput struct {
+	Object string            `json:"object"`
+	Args   []string          `json:"args"`
+	Env    map[string]string `json:"env"`
+}
+
+func (s ScriptRecord) input() scriptInput {
+	return scriptInput{Object: s.Object, Args: s.Args, Env: s.Env}
+}
+
+// Recording is a record of the scripts invoked by a run, in order. It is
+// safe for concurrent use.
+type Recording struct {
+	Path string
+
+	mu       sync.Mutex
+	records  []ScriptRecord
+	replayed []bool
+}
+
+type recordingFile struct {
+	Scripts []ScriptRecord `json:"scripts"`
+}
+
+// NewRecording returns an empty recording to be written to path.
+func NewRecording(path string) *Recording {
+	return &Recording{Path: path}
+}
+
+// ReadRecording reads the recording at path to be replayed.
+func ReadRecording(path string) (*Recording, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file recordingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("Invalid recording %s: %s", path, err)
+	}
+
+	return &Recording{
+		Path:     path,
+		records:  file.Scripts,
+		replayed: make([]bool, len(file.Scripts)),
+	}, nil
+}
+
+// Write writes the recording to its path.
+func (r *Recording) Write() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := r.records
+	if records == nil {
+		records = []ScriptRecord{}
+	}
+
+	data, err := json.MarshalIndent(recordingFile{Scripts: records}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.Path, append(data, '\n'), 0644)
+}
+
+func (r *Recording) add(record ScriptRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+// replay returns the first record of the invocation's object not yet
+// replayed, with an error showing the difference if the invocation doesn't
+// match it.
+func (r *Recording) replay(invocation ScriptRecord) (ScriptRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, record := range r.records {
+		if r.replayed[i] || record.Object != invocation.Object {
+			continue
+		}
+		r.replayed[i] = true
+
+		wantJSON, _ := json.MarshalIndent(record.input(), "", "  ")
+		gotJSON, _ := json.MarshalIndent(invocation.input(), "", "  ")
+
+		if string(wantJSON) != string(gotJSON) {
+			return record, fmt.Errorf("Invocation does not match its recording in %s:\n%s", r.Path, strings.Join(textdiff.Lines(string(wantJSON), string(gotJSON)), "\n"))
+		}
+
+		return record, nil
+	}
+
+	return ScriptRecord{}, fmt.Errorf("No more invocations of %q are recorded in %s", invocation.Object, r.Path)
+}
+
+// unreplayed returns an error listing the records that weren't replayed.
+func (r *Recording) unreplayed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var objects []string
+	for i, record := range r.records {
+		if !r.replayed[i] {
+			objects = append(objects, fmt.Sprintf("%q", record.Object))
+		}
+	}
+
+	if len(objects) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("Recorded invocations of %s in %s were not replayed", strings.Join(objects, ", "), r.Path)
+}
+
+// recordArgs returns the arguments of a command as recorded, so that they
+// don't depend on the machine: a command in the project directory is made
+// relative to it, and another absolute command is reduced to its name.
+func recordArgs(projectDir string, args []string) []string {
+	recorded := append([]string{}, args...)
+	if len(recorded) == 0 || !filepath.IsAbs(recorded[0]) {
+		return recorded
+	}
+
+	if rel, err := filepath.Rel(projectDir, recorded[0]); err == nil && !strings.HasPrefix(rel, "..") {
+		recorded[0] = "./" + filepath.ToSlash(rel)
+	} else {
+		recorded[0] = filepath.Base(recorded[0])
+	}
+
+	return recorded
+}
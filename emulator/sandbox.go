@@ -0,0 +1,177 @@
+package emulator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// stubs are the commands that a sandbox replaces with stubs that log their
+// invocations instead of acting on the machine.
+var stubs = []string{"open", "osascript", "pbcopy"}
+
+// systemPath is the PATH that Alfred runs scripts with.
+const systemPath = "/usr/bin:/bin:/usr/sbin:/sbin"
+
+// stubScript logs the name, arguments, and standard input of an invocation,
+// each followed by a NUL byte. A record is written to the log in one append,
+// so that records of concurrent invocations aren't interleaved.
+const stubScript = `#!/bin/sh
+# A stub installed by alpaca's sandbox, which logs its invocations.
+record=$(mktemp "${TMPDIR:-/tmp}/alpaca-stub.XXXXXX") || exit 1
+{
+  printf '%%s\0' %q "$#" "$@"
+  if [ ! -t 0 ]; then cat; fi
+  printf '\0'
+} > "$record"
+cat "$record" >> %q
+rm -f "$record"
+`
+
+// Sandbox is a temporary home directory that workflow scripts run in, so they
+// can't read or change the real one. It has the workflow's data and cache
+// directories, a synthetic Alfred preferences tree, and stubs of commands
+// that would act on the machine.
+type Sandbox struct {
+	Dir string
+
+	Home        string
+	Data        string
+	Cache       string
+	Preferences string
+	Tmp         string
+	Bin         string
+
+	log string
+}
+
+// Invocation is an invocation of a stubbed command in a sandbox.
+type Invocation struct {
+	Command string
+	Args    []string
+	Stdin   string
+}
+
+func (i Invocation) String() string {
+	parts := []string{i.Command}
+	for _, arg := range i.Args {
+		parts = append(parts, strconv.Quote(arg))
+	}
+	s := strings.Join(parts, " ")
+	if i.Stdin != "" {
+		s += fmt.Sprintf(" <<< %q", i.Stdin)
+	}
+	return s
+}
+
+// NewSandbox creates a sandbox for the workflow of the project in dir with
+// the given bundle ID.
+func NewSandbox(dir string, bundleID string) (*Sandbox, error) {
+	root, err := ioutil.TempDir("", "alpaca-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+
+	home := filepath.Join(root, "home")
+	s := &Sandbox{
+		Dir:         root,
+		Home:        home,
+		Data:        filepath.Join(home, "Library/Application Support/Alfred/Workflow Data", bundleID),
+		Cache:       filepath.Join(home, "Library/Caches/com.runningwithcrayons.Alfred/Workflow Data", bundleID),
+		Preferences: filepath.Join(home, "Library/Application Support/Alfred/Alfred.alfredpreferences"),
+		Tmp:         filepath.Join(root, "tmp"),
+		Bin:         filepath.Join(root, "bin"),
+		log:         filepath.Join(root, "invocations"),
+	}
+
+	if err := s.create(dir); err != nil {
+		os.RemoveAll(root)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Sandbox) create(projectDir string) error {
+	dirs := []string{
+		s.Data,
+		s.Cache,
+		s.Tmp,
+		s.Bin,
+		filepath.Join(s.Preferences, "preferences/local", localHash),
+		filepath.Join(s.Preferences, "resources"),
+		filepath.Join(s.Preferences, "workflows"),
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	// Alfred runs scripts in the workflow's directory in its preferences.
+	if err := os.Symlink(projectDir, filepath.Join(s.Preferences, "workflows", workflowUID)); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(s.log, nil, 0644); err != nil {
+		return err
+	}
+
+	for _, name := range stubs {
+		script := fmt.Sprintf(stubScript, name, s.log)
+		if err := ioutil.WriteFile(filepath.Join(s.Bin, name), []byte(script), 0755); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Invocations returns the invocations of the sandbox's stubs, in order.
+func (s *Sandbox) Invocations() ([]Invocation, error) {
+	data, err := ioutil.ReadFile(s.log)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := bytes.Split(data, []byte{0})
+	var invocations []Invocation
+	for i := 0; i+2 < len(fields); {
+		inv := Invocation{Command: string(fields[i])}
+
+		argc, err := strconv.Atoi(string(fields[i+1]))
+		if err != nil || i+2+argc >= len(fields) {
+			return nil, fmt.Errorf("Malformed invocation log %s", s.log)
+		}
+
+		for _, arg := range fields[i+2 : i+2+argc] {
+			inv.Args = append(inv.Args, string(arg))
+		}
+		inv.Stdin = string(fields[i+2+argc])
+
+		invocations = append(invocations, inv)
+		i += 3 + argc
+	}
+
+	return invocations, nil
+}
+
+// environ returns the clean environment that scripts in the sandbox start
+// from: Alfred's PATH preceded by the stubs, and HOME and TMPDIR in the
+// sandbox.
+func (s *Sandbox) environ() []string {
+	return []string{
+		"HOME=" + s.Home,
+		"PATH=" + s.Bin + ":" + systemPath,
+		"TMPDIR=" + s.Tmp,
+	}
+}
+
+// Close removes the sandbox.
+func (s *Sandbox) Close() error {
+	return os.RemoveAll(s.Dir)
+}
@@ -0,0 +1,325 @@
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jclem/alpaca/config"
+)
+
+// interpreters are the commands that run inline scripts of each type, and
+// the flag they take to run a script given as an argument.
+var interpreters = map[string][]string{
+	"bash":         {"bash", "-c"},
+	"zsh":          {"zsh", "-c"},
+	"php":          {"php", "-r"},
+	"ruby":         {"ruby", "-e"},
+	"python":       {"python3", "-c"},
+	"perl":         {"perl", "-e"},
+	"osascript-as": {"osascript", "-e"},
+	"osascript-js": {"osascript", "-l", "JavaScript", "-e"},
+}
+
+// waitDelay is how long to wait for a killed script to close its output.
+const waitDelay = time.Second
+
+// scriptResult is the output of a script run.
+type scriptResult struct {
+	stdout string
+	stderr string
+}
+
+// command returns the command that runs a script with the given query, as
+// Alfred would. Scripts that take their input as "{query}" have it
+// substituted into their content, escaped with the given options. Other
+// scripts get it as their first argument.
+func (r *Runner) command(script config.ScriptConfig, query string, vars map[string]string, escaping []string) (*exec.Cmd, error) {
+	var args []string
+	if script.ArgType != "query" {
+		args = []string{query}
+	}
+
+	if script.Go != "" {
+		pkg := "./" + filepath.ToSlash(filepath.Clean(script.Go))
+		return exec.CommandContext(r.context(), "go", append([]string{"run", pkg}, args...)...), nil
+	}
+
+	if script.Path != "" {
+		path := filepath.Join(r.Dir, script.Path)
+
+		// Scripts are packed executable, and Alfred runs those without a
+		// shebang line with the interpreter of their type, so only executable
+		// scripts with one are run directly.
+		if script.Type == "external" && isExecutable(path) {
+			return exec.CommandContext(r.context(), path, args...), nil
+		}
+
+		interpreter, ok := interpreters[script.Language]
+		if !ok {
+			return nil, fmt.Errorf("Unable to run script %q, which is not executable", script.Path)
+		}
+
+		flags := append([]string{}, interpreter[1:len(interpreter)-1]...)
+		flags = append(flags, path)
+		return exec.CommandContext(r.context(), r.interpreterName(interpreter[0]), append(flags, args...)...), nil
+	}
+
+	interpreter, ok := interpreters[script.Type]
+	if !ok {
+		return nil, fmt.Errorf("Unable to run scripts of type %q", script.Type)
+	}
+
+	content := script.Content
+	if script.ArgType == "query" {
+		content = substitute(content, query, vars, func(s string) string { return escape(s, escaping) })
+	}
+
+	if script.Type == "php" {
+		content = strings.TrimPrefix(strings.TrimSpace(content), "<?php")
+	}
+
+	name := r.interpreterName(interpreter[0])
+
+	flags := append([]string{}, interpreter[1:]...)
+	flags = append(flags, content)
+
+	// Shells take the name of the script before its arguments.
+	if script.Type == "bash" || script.Type == "zsh" {
+		flags = append(flags, "alpaca")
+	}
+
+	// Only JavaScript for Automation receives arguments from osascript -e.
+	if script.Type == "osascript-as" {
+		args = nil
+	}
+
+	return exec.CommandContext(r.context(), name, append(flags, args...)...), nil
+}
+
+// interpreterName returns the command to run the named interpreter, which is
+// the sandbox's stub for osascript.
+func (r *Runner) interpreterName(name string) string {
+	if r.sandbox != nil && name == "osascript" {
+		return filepath.Join(r.sandbox.Bin, name)
+	}
+	return name
+}
+
+// isExecutable returns whether the file at path exists and is executable.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&0111 != 0
+}
+
+// runScript runs a script of the named object with the given query in the
+// project directory, returning an error with its stderr if it fails. With a
+// recording, the invocation is recorded, or replayed instead of running the
+// script.
+func (r *Runner) runScript(name string, script config.ScriptConfig, query string, vars map[string]string, escaping []string) (*scriptResult, error) {
+	cmd, err := r.command(script, query, vars, escaping)
+	if err != nil {
+		return nil, err
+	}
+
+	invocation := ScriptRecord{Object: name, Args: recordArgs(r.Dir, cmd.Args), Env: make(map[string]string)}
+	for k, v := range vars {
+		invocation.Env[k] = v
+	}
+
+	if r.Recording != nil && r.RecordMode == Replay {
+		record, err := r.Recording.replay(invocation)
+		if err != nil {
+			return nil, err
+		}
+		if record.ExitStatus != 0 {
+			return nil, scriptFailure(fmt.Sprintf("exit status %d", record.ExitStatus), record.Stderr)
+		}
+		return &scriptResult{stdout: record.Stdout, stderr: record.Stderr}, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Dir = r.Dir
+	cmd.Env = r.environ(vars)
+	if script.Go != "" && r.sandbox != nil {
+		cmd.Env = append(cmd.Env, goEnviron()...)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = runCommand(r.context(), cmd)
+	if err != nil && r.context().Err() != nil {
+		if r.context().Err() == context.DeadlineExceeded {
+			return nil, errTimeout
+		}
+		return nil, r.context().Err()
+	}
+
+	exitErr, exited := err.(*exec.ExitError)
+	if r.Recording != nil && r.RecordMode == Record && (err == nil || exited) {
+		invocation.Stdout = stdout.String()
+		invocation.Stderr = stderr.String()
+		if exited {
+			invocation.ExitStatus = exitErr.ExitCode()
+		}
+		r.Recording.add(invocation)
+	}
+
+	if err != nil {
+		return nil, scriptFailure(err.Error(), stderr.String())
+	}
+
+	return &scriptResult{stdout: stdout.String(), stderr: stderr.String()}, nil
+}
+
+// runCommand runs a command in its own process group, and kills the whole
+// group when ctx is done, so that the processes a script forks are killed
+// with it. Processes that leave the group may keep its output open, so the
+// command is only waited for for waitDelay after it is killed.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-exited:
+		return err
+	case <-ctx.Done():
+	}
+
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(waitDelay):
+		return ctx.Err()
+	}
+}
+
+// scriptFailure returns the error of a failed script, with its stderr.
+func scriptFailure(reason string, stderr string) error {
+	msg := strings.TrimSpace(stderr)
+	if msg == "" {
+		return fmt.Errorf("Script failed: %s", reason)
+	}
+	return fmt.Errorf("Script failed: %s\n%s", reason, msg)
+}
+
+// runAppleScript runs the content of an AppleScript object with osascript,
+// calling its alfred_script handler with the query as Alfred does.
+func (r *Runner) runAppleScript(name string, cfg config.AppleScript, query string, vars map[string]string) (*scriptResult, error) {
+	if _, err := exec.LookPath("osascript"); err != nil && r.sandbox == nil && r.Recording == nil {
+		return nil, errNotRunnable
+	}
+
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(query)
+	content := cfg.Content + "\nalfred_script(\"" + quoted + "\")\n"
+
+	script := config.ScriptConfig{Type: "osascript-as", Content: content, ArgType: "argv"}
+	return r.runScript(name, script, query, vars, nil)
+}
+
+// context returns the context scripts are run with.
+func (r *Runner) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+const (
+	// workflowUID is the name of the workflow's directory in Alfred's
+	// preferences when it runs locally.
+	workflowUID = "user.workflow.alpaca"
+
+	// localHash is the hash of the machine's local preferences.
+	localHash = "alpaca"
+)
+
+// environ returns the environment of scripts, with the variables Alfred sets
+// for workflows, and the given workflow variables. Scripts run in a sandbox
+// get a clean environment with its directories, and otherwise this process's
+// environment with the real ones.
+func (r *Runner) environ(vars map[string]string) []string {
+	bundleID := r.Config.BundleID
+
+	var env []string
+	var data, cache, preferences string
+	if r.sandbox != nil {
+		env = r.sandbox.environ()
+		data, cache, preferences = r.sandbox.Data, r.sandbox.Cache, r.sandbox.Preferences
+	} else {
+		home, _ := os.UserHomeDir()
+		env = os.Environ()
+		data = filepath.Join(home, "Library/Application Support/Alfred/Workflow Data", bundleID)
+		cache = filepath.Join(home, "Library/Caches/com.runningwithcrayons.Alfred/Workflow Data", bundleID)
+		preferences = filepath.Join(home, "Library/Application Support/Alfred/Alfred.alfredpreferences")
+	}
+
+	env = append(env,
+		"alfred_version=5.0",
+		"alfred_version_build=2058",
+		"alfred_debug=1",
+		"alfred_preferences="+preferences,
+		"alfred_preferences_localhash="+localHash,
+		"alfred_theme=theme.bundled.default",
+		"alfred_theme_background=rgba(255,255,255,0.98)",
+		"alfred_theme_subtext=3",
+		"alfred_workflow_bundleid="+bundleID,
+		"alfred_workflow_cache="+cache,
+		"alfred_workflow_data="+data,
+		"alfred_workflow_name="+r.Config.Name,
+		"alfred_workflow_uid="+workflowUID,
+		"alfred_workflow_version="+r.Config.Version,
+	)
+
+	for name, value := range vars {
+		env = append(env, name+"="+value)
+	}
+
+	return env
+}
+
+// goVariables are the variables of this process's environment that Go
+// scripts keep in a sandbox, so that they build with its toolchain and
+// caches.
+var goVariables = []string{"GOROOT", "GOPATH", "GOCACHE", "GOMODCACHE", "GOFLAGS", "GOPROXY", "GOPRIVATE", "GONOSUMDB", "GONOPROXY", "GOSUMDB", "GOTOOLCHAIN"}
+
+// goEnviron returns the variables Go scripts keep in a sandbox, with the
+// defaults of GOPATH and GOCACHE, which are otherwise found in the home
+// directory.
+func goEnviron() []string {
+	var env []string
+	for _, name := range goVariables {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	if _, ok := os.LookupEnv("GOPATH"); !ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			env = append(env, "GOPATH="+filepath.Join(home, "go"))
+		}
+	}
+
+	if _, ok := os.LookupEnv("GOCACHE"); !ok {
+		if dir, err := os.UserCacheDir(); err == nil {
+			env = append(env, "GOCACHE="+filepath.Join(dir, "go-build"))
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,438 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jclem/alpaca/config"
+)
+
+// ScriptFilterOutput is the JSON output of a script filter.
+type ScriptFilterOutput struct {
+	Items         []Item            `json:"items"`
+	Variables     map[string]string `json:"variables,omitempty"`
+	Rerun         float64           `json:"rerun,omitempty"`
+	Cache         *Cache            `json:"cache,omitempty"`
+	SkipKnowledge bool              `json:"skipknowledge,omitempty"`
+}
+
+// Cache is how Alfred caches the output of a script filter.
+type Cache struct {
+	Seconds     int  `json:"seconds"`
+	LooseReload bool `json:"loosereload,omitempty"`
+}
+
+// Item is an item of a script filter's output.
+type Item struct {
+	UID          string            `json:"uid,omitempty"`
+	Title        string            `json:"title"`
+	Subtitle     string            `json:"subtitle,omitempty"`
+	Arg          Arg               `json:"arg,omitempty"`
+	Icon         *ItemIcon         `json:"icon,omitempty"`
+	Valid        *bool             `json:"valid,omitempty"`
+	Match        string            `json:"match,omitempty"`
+	Autocomplete string            `json:"autocomplete,omitempty"`
+	Type         string            `json:"type,omitempty"`
+	Mods         map[string]Mod    `json:"mods,omitempty"`
+	Action       json.RawMessage   `json:"action,omitempty"`
+	Text         *ItemText         `json:"text,omitempty"`
+	QuickLookURL string            `json:"quicklookurl,omitempty"`
+	Variables    map[string]string `json:"variables,omitempty"`
+}
+
+// IsValid returns whether the item can be actioned, which it can unless it
+// says otherwise.
+func (i Item) IsValid() bool {
+	return i.Valid == nil || *i.Valid
+}
+
+// Mod returns the modifier of the item for the given combination of modifier
+// keys, if it has one.
+func (i Item) Mod(mod string) (Mod, bool) {
+	mask, err := config.ModifierMask(mod)
+	if err != nil {
+		return Mod{}, false
+	}
+
+	for name, m := range i.Mods {
+		if other, _ := config.ModifierMask(name); other == mask {
+			return m, true
+		}
+	}
+
+	return Mod{}, false
+}
+
+// ModNames returns the sorted names of the item's modifiers.
+func (i Item) ModNames() []string {
+	names := make([]string, 0, len(i.Mods))
+	for name := range i.Mods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Mod is how an item behaves when actioned with modifier keys held.
+type Mod struct {
+	Valid     *bool             `json:"valid,omitempty"`
+	Arg       Arg               `json:"arg,omitempty"`
+	Subtitle  string            `json:"subtitle,omitempty"`
+	Icon      *ItemIcon         `json:"icon,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// ItemIcon is the icon of an item.
+type ItemIcon struct {
+	Type string `json:"type,omitempty"`
+	Path string `json:"path"`
+}
+
+// ItemText is the text copied or shown in large type for an item.
+type ItemText struct {
+	Copy      string `json:"copy,omitempty"`
+	LargeType string `json:"largetype,omitempty"`
+}
+
+// Arg is the argument of an item, which is a string or a list of strings.
+type Arg []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *Arg) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = Arg{s}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = Arg(list)
+
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (a Arg) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// String returns the argument as the query of the next object. Alfred passes
+// each string of a list as a separate argument, which are joined by tabs here.
+func (a Arg) String() string {
+	return strings.Join(a, "\t")
+}
+
+// ParseScriptFilterOutput parses the output of a script filter, validating it
+// against the schema Alfred documents. Every problem found is listed in the
+// returned error, with the path to the offending value.
+func ParseScriptFilterOutput(data []byte) (*ScriptFilterOutput, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line, col := position(data, syntaxErr.Offset)
+			return nil, fmt.Errorf("Invalid script filter output: %s at line %d, column %d", err, line, col)
+		}
+		return nil, fmt.Errorf("Invalid script filter output: %s", err)
+	}
+
+	v := &validator{}
+	v.output(value)
+	if len(v.problems) > 0 {
+		return nil, fmt.Errorf("Invalid script filter output:\n  %s", strings.Join(v.problems, "\n  "))
+	}
+
+	var output ScriptFilterOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("Invalid script filter output: %s", err)
+	}
+
+	return &output, nil
+}
+
+// position returns the line and column of the byte read last when a syntax
+// error was found after reading offset bytes of data.
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset > 0 {
+		offset--
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// validator collects the problems of a decoded script filter output.
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(path string, format string, args ...interface{}) {
+	problem := fmt.Sprintf(format, args...)
+	if path != "" {
+		problem = path + ": " + problem
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// object checks that value is an object, calling the check of each of its
+// fields. Fields without a check are reported as unknown.
+func (v *validator) object(path string, value interface{}, fields map[string]func(string, interface{})) (map[string]interface{}, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		v.add(path, "must be an object, got %s", typeName(value))
+		return nil, false
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		check, ok := fields[key]
+		if !ok {
+			v.add(join(path, key), "is not a known field")
+			continue
+		}
+		check(join(path, key), obj[key])
+	}
+
+	return obj, true
+}
+
+func (v *validator) output(value interface{}) {
+	obj, ok := v.object("", value, map[string]func(string, interface{}){
+		"items":         v.items,
+		"variables":     v.variables,
+		"rerun":         v.number(0.1, 5),
+		"cache":         v.cache,
+		"skipknowledge": v.boolean,
+	})
+	if ok {
+		if _, ok := obj["items"]; !ok {
+			v.add("items", "is required")
+		}
+	}
+}
+
+func (v *validator) items(path string, value interface{}) {
+	list, ok := value.([]interface{})
+	if !ok {
+		v.add(path, "must be an array, got %s", typeName(value))
+		return
+	}
+
+	for i, item := range list {
+		v.item(fmt.Sprintf("%s[%d]", path, i), item)
+	}
+}
+
+func (v *validator) item(path string, value interface{}) {
+	obj, ok := v.object(path, value, map[string]func(string, interface{}){
+		"uid":          v.str,
+		"title":        v.str,
+		"subtitle":     v.str,
+		"arg":          v.arg,
+		"icon":         v.icon,
+		"valid":        v.boolean,
+		"match":        v.str,
+		"autocomplete": v.str,
+		"type":         v.oneOf("default", "file", "file:skipcheck"),
+		"mods":         v.mods,
+		"action":       v.action,
+		"text":         v.text,
+		"quicklookurl": v.str,
+		"variables":    v.variables,
+	})
+	if ok {
+		if _, ok := obj["title"]; !ok {
+			v.add(join(path, "title"), "is required")
+		}
+	}
+}
+
+func (v *validator) mods(path string, value interface{}) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		v.add(path, "must be an object, got %s", typeName(value))
+		return
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, err := config.ModifierMask(key); err != nil {
+			v.add(join(path, key), "%s", err)
+			continue
+		}
+
+		v.object(join(path, key), obj[key], map[string]func(string, interface{}){
+			"valid":     v.boolean,
+			"arg":       v.arg,
+			"subtitle":  v.str,
+			"icon":      v.icon,
+			"variables": v.variables,
+		})
+	}
+}
+
+func (v *validator) icon(path string, value interface{}) {
+	obj, ok := v.object(path, value, map[string]func(string, interface{}){
+		"type": v.oneOf("fileicon", "filetype"),
+		"path": v.str,
+	})
+	if ok {
+		if _, ok := obj["path"]; !ok {
+			v.add(join(path, "path"), "is required")
+		}
+	}
+}
+
+func (v *validator) text(path string, value interface{}) {
+	v.object(path, value, map[string]func(string, interface{}){
+		"copy":      v.str,
+		"largetype": v.str,
+	})
+}
+
+func (v *validator) action(path string, value interface{}) {
+	if _, ok := value.(map[string]interface{}); !ok {
+		v.arg(path, value)
+		return
+	}
+
+	v.object(path, value, map[string]func(string, interface{}){
+		"text": v.arg,
+		"url":  v.arg,
+		"file": v.arg,
+		"auto": v.arg,
+	})
+}
+
+func (v *validator) cache(path string, value interface{}) {
+	obj, ok := v.object(path, value, map[string]func(string, interface{}){
+		"seconds":     v.number(5, 86400),
+		"loosereload": v.boolean,
+	})
+	if ok {
+		if _, ok := obj["seconds"]; !ok {
+			v.add(join(path, "seconds"), "is required")
+		}
+	}
+}
+
+func (v *validator) variables(path string, value interface{}) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		v.add(path, "must be an object, got %s", typeName(value))
+		return
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v.str(join(path, key), obj[key])
+	}
+}
+
+func (v *validator) arg(path string, value interface{}) {
+	switch arg := value.(type) {
+	case string:
+		return
+	case []interface{}:
+		for i, a := range arg {
+			v.str(fmt.Sprintf("%s[%d]", path, i), a)
+		}
+	default:
+		v.add(path, "must be a string or an array of strings, got %s", typeName(value))
+	}
+}
+
+func (v *validator) str(path string, value interface{}) {
+	if _, ok := value.(string); !ok {
+		v.add(path, "must be a string, got %s", typeName(value))
+	}
+}
+
+func (v *validator) boolean(path string, value interface{}) {
+	if _, ok := value.(bool); !ok {
+		v.add(path, "must be a boolean, got %s", typeName(value))
+	}
+}
+
+func (v *validator) number(min float64, max float64) func(string, interface{}) {
+	return func(path string, value interface{}) {
+		n, ok := value.(float64)
+		if !ok {
+			v.add(path, "must be a number, got %s", typeName(value))
+			return
+		}
+		if n < min || n > max {
+			v.add(path, "must be between %g and %g, got %g", min, max, n)
+		}
+	}
+}
+
+func (v *validator) oneOf(values ...string) func(string, interface{}) {
+	return func(path string, value interface{}) {
+		s, ok := value.(string)
+		if !ok {
+			v.add(path, "must be a string, got %s", typeName(value))
+			return
+		}
+		for _, allowed := range values {
+			if s == allowed {
+				return
+			}
+		}
+		v.add(path, "must be one of %s, got %q", strings.Join(values, ", "), s)
+	}
+}
+
+// join returns the path of a field of the object at path.
+func join(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// typeName returns the JSON type of a decoded value.
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
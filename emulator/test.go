@@ -0,0 +1,245 @@
+package emulator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jclem/alpaca/config"
+)
+
+// TestResult is the result of a workflow test.
+type TestResult struct {
+	Test config.Test
+
+	// Failures describe every expectation of the test that wasn't met, or
+	// why the workflow could not be run.
+	Failures []string
+
+	Duration time.Duration
+}
+
+// Passed returns whether the test passed.
+func (t TestResult) Passed() bool {
+	return len(t.Failures) == 0
+}
+
+// RunTests runs tests, at most jobs at a time, and returns their results in
+// the order of the tests.
+func (r *Runner) RunTests(tests []config.Test, jobs int) []TestResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]TestResult, len(tests))
+	sem := make(chan struct{}, jobs)
+
+	var wg sync.WaitGroup
+	for i, test := range tests {
+		wg.Add(1)
+		go func(i int, test config.Test) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = r.RunTest(test)
+		}(i, test)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// RunTest runs the workflow from the trigger of a test, with its query,
+// variables, and chosen item, and checks the result against its
+// expectations. The run is stopped if it takes longer than the test's
+// timeout. A test with a recording replays it, or records it anew if the
+// runner's RecordMode is Record.
+func (r *Runner) RunTest(test config.Test) TestResult {
+	start := time.Now()
+	res := TestResult{Test: test}
+
+	runner := *r
+	runner.Variables = make(map[string]string)
+	for _, set := range []map[string]string{r.Variables, test.Variables} {
+		for k, v := range set {
+			runner.Variables[k] = v
+		}
+	}
+	runner.Choose = func(object string, output *ScriptFilterOutput) (Selection, bool, error) {
+		if test.Item > 0 {
+			return Selection{Item: test.Item - 1, Mod: test.Mod}, true, nil
+		}
+		sel, ok, err := FirstValid(object, output)
+		sel.Mod = test.Mod
+		return sel, ok, err
+	}
+
+	runner.Recording = nil
+	if test.Recording != "" {
+		path := test.Recording
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.Dir, path)
+		}
+
+		if r.RecordMode == Record {
+			runner.Recording = NewRecording(path)
+		} else {
+			recording, err := ReadRecording(path)
+			if err != nil {
+				res.Failures = []string{fmt.Sprintf("Unable to read recording: %s", err)}
+				return res
+			}
+			runner.Recording = recording
+		}
+	}
+
+	timeout := test.Duration()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := runner.RunContext(ctx, test.Trigger, test.Query)
+	res.Duration = time.Since(start)
+
+	if runner.Recording != nil && r.RecordMode == Record && ctx.Err() == nil {
+		if writeErr := runner.Recording.Write(); writeErr != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("Unable to write recording: %s", writeErr))
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		res.Failures = []string{fmt.Sprintf("Timed out after %s", timeout)}
+		return res
+	}
+	if err != nil {
+		res.Failures = append(res.Failures, fmt.Sprintf("Run failed: %s", err))
+		return res
+	}
+
+	res.Failures = append(res.Failures, check(test.Expect, result)...)
+	return res
+}
+
+// check returns a description of every expectation the result of a run
+// doesn't meet.
+func check(expect config.Expectations, result *Result) []string {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+
+	if expect.Items != nil {
+		var output *ScriptFilterOutput
+		for _, step := range result.Trace {
+			if step.Output != nil {
+				output = step.Output
+				break
+			}
+		}
+
+		switch {
+		case output == nil:
+			fail("items: no script filter was run")
+		case len(output.Items) != len(expect.Items):
+			fail("items: expected %d items, got %d", len(expect.Items), len(output.Items))
+		default:
+			for i, want := range expect.Items {
+				got := output.Items[i]
+				path := fmt.Sprintf("items[%d]", i)
+				checkString(fail, path+".title", want.Title, got.Title)
+				checkString(fail, path+".subtitle", want.Subtitle, got.Subtitle)
+				checkString(fail, path+".arg", want.Arg, got.Arg.String())
+				if want.Valid != nil && *want.Valid != got.IsValid() {
+					fail("%s.valid: expected %t, got %t", path, *want.Valid, got.IsValid())
+				}
+			}
+		}
+	}
+
+	if expect.Clipboard != nil {
+		var copied *string
+		for _, output := range result.Outputs {
+			if output.Type == config.ClipboardType {
+				value := output.Value
+				copied = &value
+			}
+		}
+
+		if copied == nil {
+			fail("clipboard: expected %q, nothing was copied", *expect.Clipboard)
+		} else {
+			checkString(fail, "clipboard", expect.Clipboard, *copied)
+		}
+	}
+
+	if expect.URLs != nil {
+		urls := []string{}
+		for _, output := range result.Outputs {
+			if output.Type == config.OpenURLType {
+				urls = append(urls, output.Value)
+			}
+		}
+
+		if !reflect.DeepEqual(urls, expect.URLs) {
+			fail("urls: expected %q, got %q", expect.URLs, urls)
+		}
+	}
+
+	if expect.Commands != nil {
+		if len(result.Invocations) != len(expect.Commands) {
+			fail("commands: expected %d commands, got %d: %s", len(expect.Commands), len(result.Invocations), invocationList(result.Invocations))
+		} else {
+			for i, want := range expect.Commands {
+				got := result.Invocations[i]
+				path := fmt.Sprintf("commands[%d]", i)
+				if want.Command != got.Command {
+					fail("%s.command: expected %q, got %q", path, want.Command, got.Command)
+				}
+				if want.Args != nil && !reflect.DeepEqual(want.Args, got.Args) {
+					fail("%s.args: expected %q, got %q", path, want.Args, got.Args)
+				}
+				checkString(fail, path+".stdin", want.Stdin, got.Stdin)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(expect.Variables))
+	for name := range expect.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, ok := result.Variables[name]
+		if !ok {
+			fail("variables.%s: expected %q, it was not set", name, expect.Variables[name])
+			continue
+		}
+		want := expect.Variables[name]
+		checkString(fail, "variables."+name, &want, value)
+	}
+
+	return failures
+}
+
+func invocationList(invocations []Invocation) string {
+	if len(invocations) == 0 {
+		return "none"
+	}
+	list := make([]string, len(invocations))
+	for i, inv := range invocations {
+		list[i] = inv.String()
+	}
+	return strings.Join(list, "; ")
+}
+
+func checkString(fail func(string, ...interface{}), path string, want *string, got string) {
+	if want != nil && *want != got {
+		fail("%s: expected %q, got %q", path, *want, got)
+	}
+}
@@ -1,176 +1,314 @@
 package project
 
 import (
-	"archive/zip"
-	"fmt"
-	"io"
+	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/groob/plist"
 	"github.com/jclem/alpaca/config"
-	"github.com/jclem/alpaca/workflow"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
 )
 
-// Build builds an Alpaca project into the given targetPath
-func Build(projectDir string, targetDir string) error {
-	cfg, err := readConfig(projectDir)
+// DefaultFileName is the default template for the name of a workflow file.
+const DefaultFileName = "{name}.alfredworkflow"
+
+// BuildOptions configures how a project is built.
+type BuildOptions struct {
+	// Profile is the name of the config profile to build with, if any.
+	Profile string
+
+	// FileName is the template for the name of the workflow file, see
+	// Project.FileName. It defaults to DefaultFileName.
+	FileName string
+
+	// EmbedManifest determines whether a manifest of the packed files is
+	// packed into the workflow.
+	EmbedManifest bool
+
+	// WriteManifest determines whether a manifest of the packed files is
+	// written alongside the workflow file.
+	WriteManifest bool
+
+	// SigningKey, if set, is used to sign the manifest, writing a detached
+	// signature alongside the workflow file. Signing requires a manifest.
+	SigningKey ed25519.PrivateKey
+
+	// Force determines whether a workflow file is built even if it is up to
+	// date with the project.
+	Force bool
+
+	// NoHooks determines whether the project's hooks are skipped.
+	NoHooks bool
+}
+
+// Project is an Alpaca project read from a directory.
+type Project struct {
+	Dir        string
+	Config     *config.Config
+	configPath string
+	opts       BuildOptions
+}
+
+// Load reads the project in dir to be built with the given options.
+func Load(dir string, opts BuildOptions) (*Project, error) {
+	cfg, configPath, err := ReadConfig(dir, opts.Profile)
 	if err != nil {
-		return errors.Wrap(err, "Unable to read project config")
+		return nil, errors.Wrap(err, "Unable to read project config")
 	}
 
-	targetPath := filepath.Join(targetDir, fmt.Sprintf("%s.alfredworkflow", cfg.Name))
+	return &Project{Dir: dir, Config: cfg, configPath: configPath, opts: opts}, nil
+}
 
-	workflowFile, err := os.Create(targetPath)
+// Build builds an Alpaca project into a workflow file in targetDir, returning
+// the path of the file and whether it was already up to date, in which case
+// it is left untouched. Compressed and generated files are cached in the
+// project's CacheDir between builds.
+//
+// The project's pre-pack hooks run first, after which the project is read
+// again, since hooks may change it. Its post-pack hooks run once the workflow
+// file is written, unless it was up to date.
+func Build(projectDir string, targetDir string, opts BuildOptions) (string, bool, error) {
+	p, err := Load(projectDir, opts)
 	if err != nil {
-		return errors.Wrap(err, "Error creating workflow package file")
+		return "", false, err
 	}
-	defer workflowFile.Close()
 
-	archive := zip.NewWriter(workflowFile)
-	defer archive.Close()
+	targetPath := filepath.Join(targetDir, p.FileName(opts.FileName))
 
-	writer, err := archive.Create("info.plist")
+	if p, err = p.RunPrePackHooks(targetPath); err != nil {
+		return "", false, err
+	}
+
+	files, err := collectFiles(p.Dir, p.configPath, targetPath, p.Config)
 	if err != nil {
-		return errors.Wrap(err, "Error creating plist file in archive")
+		return "", false, err
 	}
 
-	info, err := workflow.NewFromConfig(projectDir, *cfg)
+	cache := openCache(projectDir)
+
+	key, err := p.buildKey(files)
 	if err != nil {
-		return errors.Wrap(err, "Error creating worfklow from configuration")
+		return "", false, errors.Wrap(err, "Error hashing project files")
 	}
-	plistBytes, err := plist.MarshalIndent(info, "\t")
+
+	if !opts.Force && cache.upToDate(targetPath, key) && p.manifestWritten(targetPath) {
+		return targetPath, true, nil
+	}
+
+	workflowFile, err := os.Create(targetPath)
 	if err != nil {
-		return errors.Wrap(err, "Error marshalling info plist")
+		return "", false, errors.Wrap(err, "Error creating workflow package file")
 	}
+	defer workflowFile.Close()
 
-	writer.Write(plistBytes)
+	manifest, err := p.write(newCachedZipOutput(workflowFile, cache), files, cache)
+	if err != nil {
+		return "", false, err
+	}
 
-	if cfg.Icon != "" {
-		src := filepath.Join(projectDir, cfg.Icon)
-		ext := filepath.Ext(src)
+	if err := workflowFile.Close(); err != nil {
+		return "", false, err
+	}
 
-		if ext != ".png" {
-			return fmt.Errorf("Workflow icon must be a .png, got %q", ext)
-		}
+	if err := p.WriteManifest(manifest, targetPath); err != nil {
+		return "", false, err
+	}
 
-		dst := fmt.Sprintf("%s%s", "icon", ext)
-		if err := copyFile(src, dst, archive); err != nil {
-			return errors.Wrap(err, "Error copying file")
-		}
+	if err := cache.recordBuild(targetPath, key); err != nil {
+		return "", false, errors.Wrap(err, "Error caching build")
 	}
 
-	for _, obj := range cfg.Objects {
-		if obj.Icon == "" {
-			continue
-		}
+	if err := p.RunHooks(PostPack, targetPath); err != nil {
+		return "", false, err
+	}
 
-		src := filepath.Join(projectDir, obj.Icon)
-		ext := filepath.Ext(src)
-		if ext != ".png" {
-			return fmt.Errorf("Object icon must be a .png, got %q", ext)
-		}
+	return targetPath, false, nil
+}
 
-		dst := fmt.Sprintf("%s%s", obj.UID, ext)
-		if err := copyFile(src, dst, archive); err != nil {
-			return errors.Wrap(err, "Error copying file")
-		}
+// RunPrePackHooks runs the project's pre-pack hooks for the workflow at
+// targetPath, returning the project read again if any ran.
+func (p *Project) RunPrePackHooks(targetPath string) (*Project, error) {
+	if p.opts.NoHooks || len(p.Config.Hooks.PrePack) == 0 {
+		return p, nil
 	}
 
-	if err := filepath.Walk(projectDir, func(filePath string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
+	if err := p.RunHooks(PrePack, targetPath); err != nil {
+		return nil, err
+	}
+
+	return Load(p.Dir, p.opts)
+}
 
-		if filePath == targetPath {
-			return nil
+// manifestWritten returns whether the manifest and signature that the
+// project's options ask for exist alongside the workflow at targetPath.
+func (p *Project) manifestWritten(targetPath string) bool {
+	var paths []string
+	if p.opts.WriteManifest {
+		paths = append(paths, targetPath+ManifestSuffix)
+	}
+	if p.opts.SigningKey != nil {
+		paths = append(paths, targetPath+SignatureSuffix)
+	}
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return false
 		}
+	}
 
-		if strings.HasSuffix(filePath, "info.plist") {
-			return nil
+	return true
+}
+
+// WriteManifest writes the manifest of the workflow at targetPath alongside it
+// and signs it, if the project's options ask for either.
+func (p *Project) WriteManifest(manifest *Manifest, targetPath string) error {
+	if p.opts.WriteManifest {
+		if err := manifest.WriteFile(targetPath + ManifestSuffix); err != nil {
+			return errors.Wrap(err, "Error writing manifest")
 		}
+	}
 
+	if p.opts.SigningKey != nil {
+		signature, err := manifest.Sign(p.opts.SigningKey)
 		if err != nil {
-			return err
+			return errors.Wrap(err, "Error signing manifest")
 		}
 
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
+		if err := WriteSignature(targetPath+SignatureSuffix, signature); err != nil {
+			return errors.Wrap(err, "Error writing signature")
 		}
-		name := strings.TrimPrefix(filePath, projectDir+"/")
-		header.Name = name
+	}
 
-		writer, err := archive.CreateHeader(header)
-		if err != nil {
-			return err
+	return nil
+}
+
+// FileName returns a workflow file name from a template, in which "{name}",
+// "{version}", and "{bundle-id}" are replaced with the project's values.
+func (p *Project) FileName(template string) string {
+	if template == "" {
+		template = DefaultFileName
+	}
+
+	name := strings.NewReplacer(
+		"{name}", p.Config.Name,
+		"{version}", p.Config.Version,
+		"{bundle-id}", p.Config.BundleID,
+	).Replace(template)
+
+	return strings.Replace(name, string(filepath.Separator), "-", -1)
+}
+
+// List returns the path in the workflow of every file the project packs.
+func (p *Project) List() ([]string, error) {
+	files, err := collectFiles(p.Dir, p.configPath, "", p.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.name
+	}
+
+	if p.opts.EmbedManifest {
+		names = append(names, ManifestName)
+	}
+
+	return names, nil
+}
+
+// Write builds the workflow into out and closes it, returning a manifest of
+// the files written. The file or directory at targetPath, if any, is never
+// packed.
+func (p *Project) Write(out Output, targetPath string) (*Manifest, error) {
+	files, err := collectFiles(p.Dir, p.configPath, targetPath, p.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.write(out, files, nil)
+}
+
+// write writes files into out and closes it, returning a manifest of the files
+// written. Generated files are read from and stored in the cache, if any.
+func (p *Project) write(out Output, files []file, cache *buildCache) (*Manifest, error) {
+	manifest, err := newManifest(p.Config)
+	if err != nil {
+		return nil, err
+	}
+	manifestOut := &manifestOutput{Output: out, manifest: manifest}
+
+	for _, f := range files {
+		if err := f.write(manifestOut, cache); err != nil {
+			return nil, errors.Wrapf(err, "Error writing %q to workflow", f.name)
 		}
+	}
 
-		file, err := os.Open(filePath)
+	if p.opts.EmbedManifest {
+		data, err := manifest.marshal()
 		if err != nil {
-			return err
+			return nil, errors.Wrap(err, "Error marshalling manifest")
 		}
-		defer file.Close()
-		if _, err := io.Copy(writer, file); err != nil {
-			return err
+
+		if err := out.WriteFile(ManifestName, 0644, time.Time{}, bytes.NewReader(data)); err != nil {
+			return nil, errors.Wrap(err, "Error writing manifest to workflow")
 		}
+	}
 
-		return nil
-	}); err != nil {
-		return errors.Wrap(err, "Unable to create archive")
+	if err := out.Close(); err != nil {
+		return nil, errors.Wrap(err, "Error finishing workflow")
 	}
 
-	return nil
+	return manifest, nil
 }
 
-func copyFile(from string, to string, archive *zip.Writer) error {
-	info, err := os.Stat(from)
+// ReadConfig reads and interpolates the config of the project in dir with the
+// given profile, returning the config and the path of the main config file.
+func ReadConfig(dir string, profile string) (*config.Config, string, error) {
+	cfg, filePath, err := readConfig(dir, profile)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	header, err := zip.FileInfoHeader(info)
-	header.Name = to
-
-	writer, err := archive.CreateHeader(header)
-	if err != nil {
-		return err
+	// Interpolate before loading files, so that the contents of a readme
+	// file are packed as they are written.
+	if err := cfg.Interpolate(dir); err != nil {
+		return nil, "", err
 	}
 
-	file, err := os.Open(from)
-	if err != nil {
-		return err
+	if err := cfg.LoadFiles(dir); err != nil {
+		return nil, "", err
 	}
-	defer file.Close()
 
-	if _, err := io.Copy(writer, file); err != nil {
-		return err
+	if err := cfg.ResolveScripts(dir); err != nil {
+		return nil, "", err
 	}
 
-	return nil
+	return cfg, filePath, nil
 }
 
-func readConfig(dir string) (*config.Config, error) {
+func readConfig(dir string, profile string) (*config.Config, string, error) {
 	// Try .yaml first
 	filePath := filepath.Join(dir, "alpaca.yaml")
-	cfg, err := config.Read(filePath)
+	cfg, err := config.ReadProfile(filePath, profile)
 
 	if err != nil {
 		if _, ok := err.(*os.PathError); ok {
 			// Then try .yml
 			filePath = filepath.Join(dir, "alpaca.yml")
-			cfg, err = config.Read(filePath)
+			cfg, err = config.ReadProfile(filePath, profile)
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 
-			return cfg, nil
+			return cfg, filePath, nil
 		}
 
-		return nil, err
+		return nil, "", err
 	}
 
-	return cfg, nil
+	return cfg, filePath, nil
 }
@@ -0,0 +1,190 @@
+package project
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jclem/alpaca/app/version"
+)
+
+// CacheDir is the project-relative directory that incremental builds are
+// cached in. It is never packed.
+const CacheDir = ".alpaca-cache"
+
+// buildCache stores data produced by earlier builds of a project, keyed by
+// content hashes: compressed file contents, generated files, and a record of
+// the last build of each workflow file.
+type buildCache struct {
+	dir string
+}
+
+func openCache(projectDir string) *buildCache {
+	return &buildCache{dir: filepath.Join(projectDir, CacheDir)}
+}
+
+// get returns the cached data of the given kind and key, if any.
+func (c *buildCache) get(kind string, key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, kind, key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// put caches data of the given kind and key. The data is written to a
+// temporary file first, so an interrupted build never leaves partial data.
+func (c *buildCache) put(kind string, key string, data []byte) error {
+	dir := filepath.Join(c.dir, kind)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(dir, key))
+}
+
+// buildRecord is the cached record of the last build of a workflow file.
+type buildRecord struct {
+	Key      string `json:"key"`
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"`
+}
+
+// upToDate returns whether the workflow file at targetPath was last built
+// with the given build key and hasn't changed since.
+func (c *buildCache) upToDate(targetPath string, key string) bool {
+	data, ok := c.get("builds", hashString(targetPath))
+	if !ok {
+		return false
+	}
+
+	var record buildRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return false
+	}
+
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return false
+	}
+
+	return record.Key == key && record.Size == info.Size() && record.Modified == info.ModTime().UnixNano()
+}
+
+// recordBuild records that the workflow file at targetPath was built with the
+// given build key.
+func (c *buildCache) recordBuild(targetPath string, key string) error {
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(buildRecord{Key: key, Size: info.Size(), Modified: info.ModTime().UnixNano()})
+	if err != nil {
+		return err
+	}
+
+	return c.put("builds", hashString(targetPath), data)
+}
+
+// deflate returns the contents compressed as a zip entry, reusing the result
+// of an earlier build if the same contents were compressed before.
+func (c *buildCache) deflate(contents []byte) ([]byte, error) {
+	key := hashBytes(contents)
+	if data, ok := c.get("deflate", key); ok {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(contents); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := c.put("deflate", key, buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// buildKey returns a hash of everything a built workflow depends on: the
+// version of Alpaca, the build options, the resolved config, and the path,
+// mode, and contents of every packed file.
+func (p *Project) buildKey(files []file) (string, error) {
+	h := sha256.New()
+
+	configHash, err := hashConfig(p.Config)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%t\x00%t\x00%s\x00",
+		version.Version,
+		p.opts.Profile,
+		p.opts.FileName,
+		p.opts.EmbedManifest,
+		p.opts.WriteManifest,
+		configHash)
+
+	if p.opts.SigningKey != nil {
+		fmt.Fprintf(h, "%x\x00", p.opts.SigningKey.Public())
+	}
+
+	for _, f := range files {
+		digest, err := f.digest()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00%s\x00", f.name, f.mode, digest)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hashString(s string) string {
+	return hashBytes([]byte(s))
+}
+
+// hashReader returns the SHA-256 of everything read from r.
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
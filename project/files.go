@@ -0,0 +1,315 @@
+package project
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/groob/plist"
+	"github.com/jclem/alpaca/app/version"
+	"github.com/jclem/alpaca/config"
+	"github.com/jclem/alpaca/workflow"
+	"github.com/pkg/errors"
+)
+
+// file is a file to pack into a workflow.
+type file struct {
+	// name is the slash-separated path of the file in the workflow.
+	name string
+	mode os.FileMode
+
+	// source is the path of the project file to copy, if any.
+	source string
+
+	// generate returns the contents of a file that has no source.
+	generate func() ([]byte, error)
+
+	// inputs are the paths of the project files that the contents of a
+	// generated file are produced from, if it is costly to generate. The
+	// contents of such files are cached by the digest of their inputs.
+	inputs []string
+}
+
+// digest returns a hash of the file's contents. Files generated from inputs
+// are hashed by their inputs instead, without generating them.
+func (f file) digest() (string, error) {
+	if f.source != "" {
+		source, err := os.Open(f.source)
+		if err != nil {
+			return "", err
+		}
+		defer source.Close()
+
+		return hashReader(source)
+	}
+
+	if f.inputs == nil {
+		data, err := f.generate()
+		if err != nil {
+			return "", err
+		}
+		return hashBytes(data), nil
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", version.Version, f.name)
+	for _, input := range f.inputs {
+		source, err := os.Open(input)
+		if err != nil {
+			return "", err
+		}
+		digest, err := hashReader(source)
+		source.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", input, digest)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// write writes the file to out. Generated contents are read from and stored
+// in the cache, if any.
+func (f file) write(out Output, cache *buildCache) error {
+	if f.source == "" {
+		data, err := f.contents(cache)
+		if err != nil {
+			return err
+		}
+		return out.WriteFile(f.name, f.mode, time.Time{}, bytes.NewReader(data))
+	}
+
+	source, err := os.Open(f.source)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	return out.WriteFile(f.name, f.mode, info.ModTime(), source)
+}
+
+// contents returns the contents of a generated file.
+func (f file) contents(cache *buildCache) ([]byte, error) {
+	if cache == nil || f.inputs == nil {
+		return f.generate()
+	}
+
+	digest, err := f.digest()
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := cache.get("generated", digest); ok {
+		return data, nil
+	}
+
+	data, err := f.generate()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.put("generated", digest, data); err != nil {
+		return nil, errors.Wrap(err, "Error caching generated file")
+	}
+
+	return data, nil
+}
+
+// isGoInput returns whether the file at path is a Go source or module file.
+func isGoInput(path string) bool {
+	base := filepath.Base(path)
+	return filepath.Ext(path) == ".go" || base == "go.mod" || base == "go.sum"
+}
+
+// collectFiles returns every file to pack into the workflow for a project.
+// Contents of generated files, such as compiled scripts, are only produced
+// when written. The file or directory at targetPath is never packed.
+func collectFiles(projectDir string, configPath string, targetPath string, cfg *config.Config) ([]file, error) {
+	info, err := workflow.NewFromConfig(projectDir, *cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating worfklow from configuration")
+	}
+	plistBytes, err := plist.MarshalIndent(info, "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "Error marshalling info plist")
+	}
+
+	files := []file{{
+		name:     "info.plist",
+		mode:     0644,
+		generate: func() ([]byte, error) { return plistBytes, nil },
+	}}
+
+	icons := newIconCache()
+
+	if cfg.Icon != "" {
+		i, err := icons.read(projectDir, cfg.Icon)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, file{name: "icon.png", mode: 0644, generate: i.encode, inputs: []string{i.path}})
+	}
+
+	var objectIcons []file
+	for _, obj := range cfg.Objects {
+		if obj.Icon == "" {
+			continue
+		}
+
+		i, err := icons.read(projectDir, obj.Icon)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid icon for object %q", obj.Name)
+		}
+
+		objectIcons = append(objectIcons, file{name: obj.UID + ".png", mode: 0644, generate: i.encode, inputs: []string{i.path}})
+	}
+	sort.Slice(objectIcons, func(i, j int) bool { return objectIcons[i].name < objectIcons[j].name })
+	files = append(files, objectIcons...)
+
+	// Compile Go scripts into executable binaries. Their sources are not
+	// packed.
+	goPackageDirs := make(map[string]bool)
+	var binaries []file
+	for _, obj := range cfg.Objects {
+		script, ok := obj.Script()
+		if !ok || script.Go == "" {
+			continue
+		}
+
+		pkgDir := filepath.Join(projectDir, script.Go)
+		if goPackageDirs[pkgDir] {
+			continue
+		}
+		goPackageDirs[pkgDir] = true
+
+		binPath := script.BinaryPath()
+		if _, err := os.Stat(filepath.Join(projectDir, binPath)); err == nil {
+			return nil, fmt.Errorf("Project file %q conflicts with the binary compiled from Go script %q", binPath, script.Go)
+		}
+
+		pkg := script.Go
+		binaries = append(binaries, file{
+			name:     binPath,
+			mode:     0755,
+			generate: func() ([]byte, error) { return buildGoScript(projectDir, pkg) },
+		})
+	}
+	sort.Slice(binaries, func(i, j int) bool { return binaries[i].name < binaries[j].name })
+	binariesStart := len(files)
+	files = append(files, binaries...)
+
+	// Inlined script files are only packed if the workflow also refers to them.
+	skipped := make(map[string]bool)
+	for _, path := range cfg.InlinedFiles() {
+		skipped[filepath.Join(projectDir, path)] = true
+	}
+	for _, path := range cfg.ReferencedFiles() {
+		delete(skipped, filepath.Join(projectDir, path))
+	}
+	for _, localPath := range config.LocalPaths(configPath) {
+		skipped[localPath] = true
+	}
+
+	executable := make(map[string]bool)
+	for _, path := range cfg.ExecutableFiles() {
+		executable[filepath.Join(projectDir, path)] = true
+	}
+
+	if cfg.Assets != "" {
+		info, err := os.Stat(filepath.Join(projectDir, cfg.Assets))
+		if err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("Assets directory %q does not exist", cfg.Assets)
+		}
+	}
+
+	rules, err := readIgnoreRules(projectDir, cfg.Files, cfg.Assets)
+	if err != nil {
+		return nil, err
+	}
+
+	goInputs := []string{}
+	if err := filepath.Walk(projectDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if filePath == projectDir {
+			return nil
+		}
+
+		if filePath == targetPath {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := filepath.ToSlash(strings.TrimPrefix(filePath, projectDir+string(filepath.Separator)))
+
+		if rules.ignored(name, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if isGoInput(filePath) {
+			goInputs = append(goInputs, filePath)
+		}
+
+		if skipped[filePath] {
+			return nil
+		}
+
+		if filepath.Ext(filePath) == ".go" && goPackageDirs[filepath.Dir(filePath)] {
+			return nil
+		}
+
+		if strings.HasSuffix(filePath, "info.plist") {
+			return nil
+		}
+
+		mode := info.Mode().Perm()
+
+		// Alfred runs executable scripts directly, so they must be packed
+		// with the executable bit set.
+		if executable[filePath] {
+			mode |= 0111
+		}
+
+		files = append(files, file{name: name, mode: mode, source: filePath})
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "Unable to create archive")
+	}
+
+	// A Go script may import any package in the project, so every binary is
+	// built from all of them.
+	for i := range binaries {
+		files[binariesStart+i].inputs = goInputs
+	}
+
+	if err := checkIcons(projectDir, cfg, files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
@@ -0,0 +1,103 @@
+package project
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// goArchs are the architectures Go scripts are compiled for.
+var goArchs = []string{"amd64", "arm64"}
+
+// fatAlign is the alignment of each architecture in a universal binary, as a
+// power of two.
+const fatAlign = 14
+
+// buildGoScript compiles the Go package at the project-relative path pkg for
+// every architecture in goArchs and returns them merged into a universal
+// macOS binary.
+func buildGoScript(projectDir string, pkg string) ([]byte, error) {
+	tmp, err := ioutil.TempDir("", "alpaca-go")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	binaries := make([][]byte, 0, len(goArchs))
+
+	for _, arch := range goArchs {
+		out := filepath.Join(tmp, arch)
+
+		cmd := exec.Command("go", "build", "-o", out, "./"+filepath.Clean(pkg))
+		cmd.Dir = projectDir
+		cmd.Env = append(os.Environ(), "GOOS=darwin", "GOARCH="+arch, "CGO_ENABLED=0")
+
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("Error compiling Go script %q for %s: %s\n%s", pkg, arch, err, output)
+		}
+
+		binary, err := ioutil.ReadFile(out)
+		if err != nil {
+			return nil, err
+		}
+		binaries = append(binaries, binary)
+	}
+
+	return universalBinary(binaries)
+}
+
+// universalBinary merges thin Mach-O binaries into a single universal binary.
+func universalBinary(binaries [][]byte) ([]byte, error) {
+	type fatArch struct {
+		CPU    uint32
+		SubCPU uint32
+		Offset uint32
+		Size   uint32
+		Align  uint32
+	}
+
+	align := uint32(1) << fatAlign
+	offset := alignUp(uint32(8+20*len(binaries)), align)
+	archs := make([]fatArch, len(binaries))
+
+	for i, bin := range binaries {
+		file, err := macho.NewFile(bytes.NewReader(bin))
+		if err != nil {
+			return nil, errors.Wrap(err, "Error reading compiled binary")
+		}
+
+		archs[i] = fatArch{
+			CPU:    uint32(file.Cpu),
+			SubCPU: file.SubCpu,
+			Offset: offset,
+			Size:   uint32(len(bin)),
+			Align:  fatAlign,
+		}
+		offset = alignUp(offset+uint32(len(bin)), align)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(macho.MagicFat))
+	binary.Write(&buf, binary.BigEndian, uint32(len(archs)))
+	for _, arch := range archs {
+		binary.Write(&buf, binary.BigEndian, arch)
+	}
+
+	for i, bin := range binaries {
+		buf.Write(make([]byte, int(archs[i].Offset)-buf.Len()))
+		buf.Write(bin)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func alignUp(n uint32, align uint32) uint32 {
+	return (n + align - 1) / align * align
+}
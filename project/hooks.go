@@ -0,0 +1,74 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Hook stages, in the order they run.
+const (
+	PrePack  = "pre-pack"
+	PostPack = "post-pack"
+)
+
+// RunHooks runs the project's hook commands for the given stage in order,
+// with the project directory as the working directory, stopping at the first
+// one that fails. targetPath is the path of the workflow being packed, or "-"
+// if it is written to stdout. Hooks are not run if the project's options
+// disable them.
+//
+// The output of hooks is written to stderr, so that it never mixes with a
+// workflow written to stdout.
+func (p *Project) RunHooks(stage string, targetPath string) error {
+	if p.opts.NoHooks {
+		return nil
+	}
+
+	var commands []string
+	switch stage {
+	case PrePack:
+		commands = p.Config.Hooks.PrePack
+	case PostPack:
+		commands = p.Config.Hooks.PostPack
+	default:
+		return fmt.Errorf("Unknown hook stage %q", stage)
+	}
+
+	env := append(os.Environ(),
+		"ALPACA_HOOK="+stage,
+		"ALPACA_PROJECT_DIR="+p.Dir,
+		"ALPACA_OUTPUT="+targetPath,
+		"ALPACA_PROFILE="+p.opts.Profile,
+		"ALPACA_NAME="+p.Config.Name,
+		"ALPACA_VERSION="+p.Config.Version,
+		"ALPACA_BUNDLE_ID="+p.Config.BundleID,
+	)
+
+	for _, command := range commands {
+		var stderr bytes.Buffer
+
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Dir = p.Dir
+		cmd.Env = env
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				return fmt.Errorf("The %s hook %q failed: %s", stage, command, err)
+			}
+			return fmt.Errorf("The %s hook %q failed: %s\n%s", stage, command, err, msg)
+		}
+
+		if _, err := io.Copy(os.Stderr, &stderr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
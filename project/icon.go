@@ -0,0 +1,161 @@
+package project
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+
+	// Icons may also be JPEG or GIF images.
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+// iconSize is the width and height, in pixels, that Alfred recommends for
+// icons. Larger icons are downscaled to it.
+const iconSize = 256
+
+// minIconSize is the smallest width and height, in pixels, of a valid icon.
+const minIconSize = 128
+
+// icon is a project image packed as a PNG icon.
+type icon struct {
+	path   string
+	source string
+	data   []byte
+	format string
+	config image.Config
+
+	// png is the processed icon, once it has been produced.
+	png []byte
+}
+
+// iconCache reads and processes each icon once, no matter how many objects
+// use it. Icons are identified by their path and then by their content, so
+// copies of the same image are processed once as well.
+type iconCache struct {
+	byPath    map[string]*icon
+	byContent map[[sha256.Size]byte]*icon
+}
+
+func newIconCache() *iconCache {
+	return &iconCache{
+		byPath:    make(map[string]*icon),
+		byContent: make(map[[sha256.Size]byte]*icon),
+	}
+}
+
+// read reads and validates the icon at the given path in the project,
+// deciding its format from its content rather than its extension.
+func (c *iconCache) read(projectDir string, name string) (*icon, error) {
+	path := filepath.Join(projectDir, name)
+
+	if i, ok := c.byPath[path]; ok {
+		return i, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	if i, ok := c.byContent[sum]; ok {
+		c.byPath[path] = i
+		return i, nil
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("Icon %q is not a PNG, JPEG, or GIF image", name)
+	}
+
+	if config.Width != config.Height {
+		return nil, fmt.Errorf("Icon %q must be square, got %dx%d", name, config.Width, config.Height)
+	}
+
+	if config.Width < minIconSize {
+		return nil, fmt.Errorf("Icon %q must be at least %dx%d, got %dx%d", name, minIconSize, minIconSize, config.Width, config.Height)
+	}
+
+	i := &icon{path: path, source: name, data: data, format: format, config: config}
+	c.byPath[path] = i
+	c.byContent[sum] = i
+
+	return i, nil
+}
+
+// encode returns the icon as a PNG no larger than iconSize. PNGs that are
+// already small enough are returned unchanged.
+func (i *icon) encode() ([]byte, error) {
+	if i.png != nil {
+		return i.png, nil
+	}
+
+	if i.format == "png" && i.config.Width <= iconSize {
+		i.png = i.data
+		return i.png, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(i.data))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode icon %q", i.source)
+	}
+
+	if i.config.Width > iconSize {
+		img = downscale(img, iconSize)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("Unable to encode icon %q", i.source)
+	}
+
+	i.png = buf.Bytes()
+	return i.png, nil
+}
+
+// downscale returns a square image of the given size, averaging the pixels of
+// the square image src that each of its pixels covers.
+func downscale(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	srcSize := bounds.Dx()
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0 := bounds.Min.Y + y*srcSize/size
+		y1 := bounds.Min.Y + (y+1)*srcSize/size
+
+		for x := 0; x < size; x++ {
+			x0 := bounds.Min.X + x*srcSize/size
+			x1 := bounds.Min.X + (x+1)*srcSize/size
+
+			// Sum alpha-premultiplied values, so transparent pixels don't
+			// bleed their color into the result.
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,223 @@
+package project
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/pkg/errors"
+)
+
+// ignoreFile is the name of the file listing project files not to pack, in
+// gitignore syntax.
+const ignoreFile = ".alpacaignore"
+
+// defaultIgnores are the patterns of project files never packed, unless
+// explicitly included.
+var defaultIgnores = []string{
+	".git",
+	".DS_Store",
+	"*.alfredworkflow",
+	"*.alfredworkflow" + ManifestSuffix,
+	"*.alfredworkflow" + SignatureSuffix,
+	"/" + CacheDir + "/",
+	"*" + TestFileSuffix,
+	"*" + RecordingFileSuffix,
+	ignoreFile,
+}
+
+// ignoreRule is a single gitignore pattern.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules is an ordered list of gitignore patterns, where later patterns
+// take precedence over earlier ones.
+type ignoreRules []ignoreRule
+
+// readIgnoreRules returns the rules for the project files not to pack: the
+// defaults, then the project's .gitignore if enabled, its .alpacaignore, the
+// exclude patterns of its config, its assets directory, which is only ignored
+// by the defaults, and finally the include patterns of its config.
+func readIgnoreRules(projectDir string, files config.Files, assets string) (ignoreRules, error) {
+	rules, err := parseIgnorePatterns(defaultIgnores)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []string{ignoreFile}
+	if files.Gitignore {
+		sources = []string{".gitignore", ignoreFile}
+	}
+
+	for _, source := range sources {
+		patterns, err := readIgnoreFile(filepath.Join(projectDir, source))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read %s", source)
+		}
+
+		sourceRules, err := parseIgnorePatterns(patterns)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid pattern in %s", source)
+		}
+		rules = append(rules, sourceRules...)
+	}
+
+	patterns := append([]string{}, files.Exclude...)
+
+	// Assets are always packed, except for the files ignored by default. Those
+	// are ignored again only inside the assets directory, so that the project's
+	// own negations still apply elsewhere.
+	if assets != "" {
+		dir := "/" + strings.Trim(filepath.ToSlash(filepath.Clean(assets)), "/")
+		patterns = append(patterns, "!"+dir+"/", "!"+dir+"/**")
+		for _, pattern := range defaultIgnores {
+			if !strings.HasPrefix(pattern, "/") {
+				pattern = dir + "/**/" + pattern
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	for _, pattern := range files.Include {
+		patterns = append(patterns, "!"+pattern)
+	}
+
+	configRules, err := parseIgnorePatterns(patterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid pattern in files config")
+	}
+
+	return append(rules, configRules...), nil
+}
+
+// ignored returns whether a slash-separated project-relative path is ignored.
+func (r ignoreRules) ignored(path string, isDir bool) bool {
+	ignored := false
+
+	for _, rule := range r {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern.MatchString(path) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+func readIgnoreFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+
+	return patterns, scanner.Err()
+}
+
+func parseIgnorePatterns(patterns []string) (ignoreRules, error) {
+	var rules ignoreRules
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimRight(pattern, " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+
+		if strings.HasPrefix(pattern, "!") {
+			rule.negate = true
+			pattern = pattern[1:]
+		} else if strings.HasPrefix(pattern, `\`) {
+			pattern = pattern[1:]
+		}
+
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly = true
+			pattern = strings.TrimRight(pattern, "/")
+		}
+
+		// Patterns without a slash match at any depth, others are relative
+		// to the project directory.
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+
+		expr := globToRegexp(pattern)
+		if !anchored {
+			expr = "(?:.*/)?" + expr
+		}
+		re, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid pattern %q", pattern)
+		}
+		rule.pattern = re
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// globToRegexp converts a gitignore glob into a regular expression.
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			expr.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**") && i+2 == len(glob):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return expr.String()
+}
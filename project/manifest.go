@@ -0,0 +1,260 @@
+package project
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jclem/alpaca/app/version"
+	"github.com/jclem/alpaca/config"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ManifestName is the path of an embedded manifest in a workflow.
+const ManifestName = "alpaca-manifest.json"
+
+// ManifestSuffix is appended to the path of a workflow to get the path of a
+// manifest written alongside it.
+const ManifestSuffix = ".manifest.json"
+
+// Manifest lists the files packed into a workflow.
+type Manifest struct {
+	AlpacaVersion string         `json:"alpaca_version"`
+	ConfigHash    string         `json:"config_hash"`
+	Files         []ManifestFile `json:"files"`
+
+	// data is the encoded manifest as it was read, which is what its
+	// signature is made over.
+	data []byte
+}
+
+// ManifestFile is a single file in a manifest.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Problem is a difference between a workflow and its manifest.
+type Problem struct {
+	Path   string
+	Reason string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s", p.Path, p.Reason)
+}
+
+func newManifest(cfg *config.Config) (*Manifest, error) {
+	configHash, err := hashConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manifest{
+		AlpacaVersion: version.Version,
+		ConfigHash:    configHash,
+		Files:         []ManifestFile{},
+	}, nil
+}
+
+// hashConfig returns the SHA-256 of the resolved config.
+func hashConfig(cfg *config.Config) (string, error) {
+	// Tests aren't part of the workflow.
+	c := *cfg
+	c.Tests = nil
+
+	bytes, err := yaml.Marshal(&c)
+	if err != nil {
+		return "", errors.Wrap(err, "Error marshalling config")
+	}
+
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ReadManifest reads the manifest of the workflow file at path, either
+// embedded in it or written alongside it.
+func ReadManifest(path string) (*Manifest, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != ManifestName {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return decodeManifest(reader)
+	}
+
+	file, err := os.Open(path + ManifestSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s has no embedded manifest, and %s does not exist", path, path+ManifestSuffix)
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return decodeManifest(file)
+}
+
+// ReadManifestFile reads a manifest from the file at path.
+func ReadManifestFile(path string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return decodeManifest(file)
+}
+
+func decodeManifest(r io.Reader) (*Manifest, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "Invalid manifest")
+	}
+	m.data = data
+
+	return &m, nil
+}
+
+// Verify recomputes the checksums of the files in the workflow file at path
+// and returns every difference from the manifest.
+func (m *Manifest) Verify(path string) ([]Problem, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	expected := make(map[string]ManifestFile)
+	for _, f := range m.Files {
+		expected[f.Path] = f
+	}
+
+	var problems []Problem
+	seen := make(map[string]bool)
+
+	for _, file := range archive.File {
+		if file.Name == ManifestName || file.FileInfo().IsDir() {
+			continue
+		}
+		seen[file.Name] = true
+
+		want, ok := expected[file.Name]
+		if !ok {
+			problems = append(problems, Problem{file.Name, "not in manifest"})
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		got, err := hashFile(file.Name, reader)
+		reader.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error reading %q", file.Name)
+		}
+
+		if got.Size != want.Size {
+			problems = append(problems, Problem{file.Name, fmt.Sprintf("size is %d, expected %d", got.Size, want.Size)})
+		} else if got.SHA256 != want.SHA256 {
+			problems = append(problems, Problem{file.Name, "checksum does not match"})
+		}
+	}
+
+	for _, f := range m.Files {
+		if !seen[f.Path] {
+			problems = append(problems, Problem{f.Path, "missing"})
+		}
+	}
+
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+
+	return problems, nil
+}
+
+// marshal returns the encoded manifest, which is the data it was read from if
+// it was read from a file.
+func (m *Manifest) marshal() ([]byte, error) {
+	if m.data != nil {
+		return m.data, nil
+	}
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// WriteFile writes the manifest as JSON to the file at path.
+func (m *Manifest) WriteFile(path string) error {
+	bytes, err := m.marshal()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+func hashFile(path string, r io.Reader) (ManifestFile, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+
+	return ManifestFile{Path: path, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// manifestOutput records every file written to an output in a manifest.
+type manifestOutput struct {
+	Output
+	manifest *Manifest
+}
+
+func (o *manifestOutput) WriteFile(name string, mode os.FileMode, modified time.Time, contents io.Reader) error {
+	h := sha256.New()
+	counter := &countingWriter{}
+
+	if err := o.Output.WriteFile(name, mode, modified, io.TeeReader(contents, io.MultiWriter(h, counter))); err != nil {
+		return err
+	}
+
+	o.manifest.Files = append(o.manifest.Files, ManifestFile{
+		Path:   name,
+		Size:   counter.n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	})
+
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
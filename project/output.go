@@ -0,0 +1,149 @@
+package project
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Output is a destination for the files of a built workflow.
+type Output interface {
+	// WriteFile writes a file with the given slash-separated path.
+	WriteFile(name string, mode os.FileMode, modified time.Time, contents io.Reader) error
+
+	// Close finishes writing the workflow.
+	Close() error
+}
+
+// zipOutput writes a workflow as a zipped .alfredworkflow file.
+type zipOutput struct {
+	archive *zip.Writer
+
+	// cache, if set, stores the compressed contents of every file, so that
+	// files are only compressed once.
+	cache *buildCache
+
+	// compressed is the cached compressed contents of the file being written.
+	compressed []byte
+}
+
+// NewZipOutput returns an output that writes a zipped workflow to w.
+func NewZipOutput(w io.Writer) Output {
+	return &zipOutput{archive: zip.NewWriter(w)}
+}
+
+// newCachedZipOutput returns an output that writes a zipped workflow to w,
+// compressing files through cache.
+func newCachedZipOutput(w io.Writer, cache *buildCache) Output {
+	o := &zipOutput{archive: zip.NewWriter(w), cache: cache}
+
+	// The archive computes the checksum and size of the uncompressed contents
+	// written to it, but its compressor writes the cached compressed contents
+	// instead of compressing them again.
+	o.archive.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return &compressedWriter{w: w, compressed: o.compressed}, nil
+	})
+
+	return o
+}
+
+func (o *zipOutput) WriteFile(name string, mode os.FileMode, modified time.Time, contents io.Reader) error {
+	if o.cache != nil {
+		data, err := ioutil.ReadAll(contents)
+		if err != nil {
+			return err
+		}
+
+		if o.compressed, err = o.cache.deflate(data); err != nil {
+			return err
+		}
+
+		contents = bytes.NewReader(data)
+	}
+
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	}
+	header.SetMode(mode)
+
+	writer, err := o.archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, contents)
+	return err
+}
+
+func (o *zipOutput) Close() error {
+	return o.archive.Close()
+}
+
+// compressedWriter discards what is written to it, writing already compressed
+// contents when closed.
+type compressedWriter struct {
+	w          io.Writer
+	compressed []byte
+}
+
+func (w *compressedWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *compressedWriter) Close() error {
+	_, err := w.w.Write(w.compressed)
+	return err
+}
+
+// dirOutput writes a workflow as an unpacked directory.
+type dirOutput struct {
+	dir string
+}
+
+// NewDirOutput returns an output that writes the files of a workflow into dir.
+func NewDirOutput(dir string) Output {
+	return &dirOutput{dir: dir}
+}
+
+func (o *dirOutput) WriteFile(name string, mode os.FileMode, modified time.Time, contents io.Reader) error {
+	path := filepath.Join(o.dir, filepath.FromSlash(name))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, contents); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// The mode given to OpenFile is subject to the umask.
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+
+	if !modified.IsZero() {
+		return os.Chtimes(path, modified, modified)
+	}
+
+	return nil
+}
+
+func (o *dirOutput) Close() error {
+	return nil
+}
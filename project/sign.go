@@ -0,0 +1,173 @@
+package project
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// SignatureSuffix is appended to the path of a workflow to get the path of
+// its detached signature.
+const SignatureSuffix = ".sig"
+
+// PublicKeySuffix is appended to the path of a private key to get the path of
+// its public key.
+const PublicKeySuffix = ".pub"
+
+const (
+	privateKeyType = "ALPACA PRIVATE KEY"
+	publicKeyType  = "ALPACA PUBLIC KEY"
+	signatureType  = "ALPACA SIGNATURE"
+)
+
+// GenerateKey generates an Ed25519 key pair, writing the private key to path
+// and the public key to path+PublicKeySuffix. Existing files are never
+// overwritten.
+func GenerateKey(path string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "Error generating key")
+	}
+
+	if err := writePEM(path, privateKeyType, private.Seed(), 0600); err != nil {
+		return err
+	}
+
+	return writePEM(path+PublicKeySuffix, publicKeyType, public, 0644)
+}
+
+// ReadPrivateKey reads a private key written by GenerateKey.
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	blocks, err := readPEM(path, privateKeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blocks) != 1 || len(blocks[0]) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s is not a valid private key", path)
+	}
+
+	return ed25519.NewKeyFromSeed(blocks[0]), nil
+}
+
+// ReadPublicKeys reads every public key in the file at path, which is either
+// a single public key written by GenerateKey or a list of them.
+func ReadPublicKeys(path string) ([]ed25519.PublicKey, error) {
+	blocks, err := readPEM(path, publicKeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("%s contains no public keys", path)
+	}
+
+	keys := make([]ed25519.PublicKey, len(blocks))
+	for i, block := range blocks {
+		if len(block) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s contains an invalid public key", path)
+		}
+		keys[i] = ed25519.PublicKey(block)
+	}
+
+	return keys, nil
+}
+
+// Sign returns a signature of the manifest made with key.
+func (m *Manifest) Sign(key ed25519.PrivateKey) ([]byte, error) {
+	data, err := m.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.Sign(key, data), nil
+}
+
+// VerifySignature returns an error unless signature is a signature of the
+// manifest made by one of keys.
+func (m *Manifest) VerifySignature(signature []byte, keys []ed25519.PublicKey) error {
+	data, err := m.marshal()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if ed25519.Verify(key, data, signature) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Signature does not match any trusted key")
+}
+
+// WriteSignature writes a signature to the file at path.
+func WriteSignature(path string, signature []byte) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return writePEM(path, signatureType, signature, 0644)
+}
+
+// ReadSignature reads the detached signature of the workflow file at path.
+func ReadSignature(path string) ([]byte, error) {
+	blocks, err := readPEM(path+SignatureSuffix, signatureType)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s is not signed, %s does not exist", path, path+SignatureSuffix)
+		}
+		return nil, err
+	}
+
+	if len(blocks) != 1 || len(blocks[0]) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%s is not a valid signature", path+SignatureSuffix)
+	}
+
+	return blocks[0], nil
+}
+
+// writePEM writes data to a new file at path as a PEM block of the given type.
+func writePEM(path string, blockType string, data []byte, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if err := pem.Encode(file, &pem.Block{Type: blockType, Bytes: data}); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// readPEM returns the contents of every PEM block in the file at path, all of
+// which must be of the given type.
+func readPEM(path string, blockType string) ([][]byte, error) {
+	rest, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks [][]byte
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != blockType {
+			return nil, fmt.Errorf("%s contains a %s, expected a %s", path, block.Type, blockType)
+		}
+
+		blocks = append(blocks, block.Bytes)
+	}
+
+	return blocks, nil
+}
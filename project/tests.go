@@ -0,0 +1,74 @@
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// TestFileSuffix is the suffix of project files defining workflow tests. They
+// are never packed.
+const TestFileSuffix = ".alpaca-test.yaml"
+
+// RecordingFileSuffix is the suffix of project files recording the scripts
+// invoked by workflow tests. They are never packed.
+const RecordingFileSuffix = ".alpaca-recording.json"
+
+// ReadTests returns the tests of the project in dir: those of its config,
+// read from configPath, then those of its test files, in order of path. No two
+// tests may share a recording, since each test records its own.
+func ReadTests(dir string, cfg *config.Config, configPath string) ([]config.Test, error) {
+	var tests []config.Test
+
+	for _, test := range cfg.Tests {
+		test.Source = configPath
+		tests = append(tests, test)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+TestFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var fileTests []config.Test
+		if err := yaml.Unmarshal(data, &fileTests); err != nil {
+			return nil, errors.Wrapf(err, "Unable to read tests from %s", filepath.Base(path))
+		}
+
+		for _, test := range fileTests {
+			test.Source = path
+			tests = append(tests, test)
+		}
+	}
+
+	recordings := make(map[string]config.Test)
+	for _, test := range tests {
+		if test.Recording == "" {
+			continue
+		}
+
+		path := test.Recording
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		if other, ok := recordings[path]; ok {
+			return nil, fmt.Errorf("Tests %q and %q may not share the recording %s", other.Title(), test.Title(), test.Recording)
+		}
+		recordings[path] = test
+	}
+
+	return tests, nil
+}
@@ -0,0 +1,118 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jclem/alpaca/config"
+	"github.com/pkg/errors"
+)
+
+// scriptFilterOutput is the part of a Script Filter JSON output that refers to
+// icons.
+type scriptFilterOutput struct {
+	Items []struct {
+		Icon *struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		} `json:"icon"`
+	} `json:"items"`
+}
+
+// checkIcons returns an error listing every icon path referenced by a list
+// filter item or a Script Filter JSON fixture that isn't packed into the
+// workflow. Alfred resolves these paths relative to the workflow directory.
+func checkIcons(projectDir string, cfg *config.Config, files []file) error {
+	packed := make(map[string]bool)
+	for _, f := range files {
+		packed[f.name] = true
+	}
+
+	var missing []string
+	check := func(source string, iconPath string) {
+		if iconPath == "" || filepath.IsAbs(iconPath) || strings.HasPrefix(iconPath, "~") {
+			return
+		}
+
+		if !packed[path.Clean(filepath.ToSlash(iconPath))] {
+			missing = append(missing, fmt.Sprintf("%s: %q is not packed", source, iconPath))
+		}
+	}
+
+	for name, obj := range cfg.Objects {
+		filter, ok := obj.Config.(config.ListFilter)
+		if !ok {
+			continue
+		}
+
+		for idx, item := range filter.Items {
+			check(fmt.Sprintf("object %q item %d", name, idx+1), item.Icon)
+		}
+	}
+
+	fixtures, err := fixturePaths(projectDir, cfg.Fixtures)
+	if err != nil {
+		return err
+	}
+
+	for _, fixture := range fixtures {
+		data, err := ioutil.ReadFile(filepath.Join(projectDir, fixture))
+		if err != nil {
+			return errors.Wrap(err, "Unable to read fixture")
+		}
+
+		var output scriptFilterOutput
+		if err := json.Unmarshal(data, &output); err != nil {
+			return errors.Wrapf(err, "Invalid fixture %q", fixture)
+		}
+
+		for idx, item := range output.Items {
+			// Icons of other types are file paths whose icons are shown, not
+			// icon files.
+			if item.Icon == nil || item.Icon.Type != "" {
+				continue
+			}
+
+			check(fmt.Sprintf("%s item %d", fixture, idx+1), item.Icon.Path)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("Missing icons:\n  %s", strings.Join(missing, "\n  "))
+	}
+
+	return nil
+}
+
+// fixturePaths returns the project-relative path of every file matched by the
+// given fixture patterns.
+func fixturePaths(projectDir string, patterns []string) ([]string, error) {
+	var paths []string
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(projectDir, pattern))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid fixture pattern %q", pattern)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("Fixture %q does not exist", pattern)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			rel, err := filepath.Rel(projectDir, match)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, rel)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,142 @@
+// Package textdiff computes line diffs of text.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines returns a line diff from a to b: the lines of both, in order, with
+// those only in a prefixed by "- ", those only in b by "+ ", and those in both
+// by "  ". Lines are matched by their longest common subsequence.
+func Lines(a string, b string) []string {
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+
+	// Lines shared at the start and end are kept out of the subsequence, which
+	// takes time and space proportional to the product of the lines left.
+	prefix := 0
+	for prefix < len(as) && prefix < len(bs) && as[prefix] == bs[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(as)-prefix && suffix < len(bs)-prefix && as[len(as)-1-suffix] == bs[len(bs)-1-suffix] {
+		suffix++
+	}
+
+	var lines []string
+	for _, line := range as[:prefix] {
+		lines = append(lines, "  "+line)
+	}
+
+	lines = append(lines, lcsLines(as[prefix:len(as)-suffix], bs[prefix:len(bs)-suffix])...)
+
+	for _, line := range as[len(as)-suffix:] {
+		lines = append(lines, "  "+line)
+	}
+
+	return lines
+}
+
+func lcsLines(a []string, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, "+ "+b[j])
+			j++
+		default:
+			lines = append(lines, "- "+a[i])
+			i++
+		}
+	}
+
+	return lines
+}
+
+// Hunks returns the changed lines of a diff returned by Lines, with up to n
+// unchanged lines around them, in hunks that each start with a header such as
+// "@@ -3,4 +3,5 @@", giving the line numbers and counts of the hunk in a and b
+// as a unified diff does. A diff without changes has no hunks.
+func Hunks(lines []string, n int) []string {
+	changed := func(i int) bool {
+		return !strings.HasPrefix(lines[i], "  ")
+	}
+
+	keep := make([]bool, len(lines))
+	for i := range lines {
+		if !changed(i) {
+			continue
+		}
+		for k := i - n; k <= i+n; k++ {
+			if k >= 0 && k < len(lines) {
+				keep[k] = true
+			}
+		}
+	}
+
+	var hunks []string
+	aLine, bLine := 1, 1
+	for i := 0; i < len(lines); {
+		if !keep[i] {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+
+		start := i
+		aStart, bStart := aLine, bLine
+		for ; i < len(lines) && keep[i]; i++ {
+			switch lines[i][0] {
+			case '-':
+				aLine++
+			case '+':
+				bLine++
+			default:
+				aLine++
+				bLine++
+			}
+		}
+
+		hunks = append(hunks, fmt.Sprintf("@@ -%s +%s @@", hunkRange(aStart, aLine-aStart), hunkRange(bStart, bLine-bStart)))
+		hunks = append(hunks, lines[start:i]...)
+	}
+
+	return hunks
+}
+
+// hunkRange formats the start and count of the lines of a hunk in one of
+// the texts, as a unified diff does.
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
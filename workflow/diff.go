@@ -0,0 +1,397 @@
+package workflow
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jclem/alpaca/textdiff"
+)
+
+const (
+	// maxDiffLines is the number of lines of the longest text file whose
+	// changes are diffed line by line. Diffing takes time and space
+	// proportional to the product of the lines of both versions.
+	maxDiffLines = 2000
+
+	// diffContext is the number of unchanged lines shown around each change
+	// in a file.
+	diffContext = 3
+)
+
+// Kinds of changes in a diff.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Diff is the semantic difference between two packed workflows: what changed
+// in their info.plist, object by object, and which files changed.
+type Diff struct {
+	Metadata    []FieldChange      `json:"metadata"`
+	Objects     []ObjectChange     `json:"objects"`
+	Connections []ConnectionChange `json:"connections"`
+	Variables   []VariableChange   `json:"variables"`
+	Files       []FileChange       `json:"files"`
+}
+
+// Empty returns whether the workflows are the same.
+func (d *Diff) Empty() bool {
+	return len(d.Metadata) == 0 && len(d.Objects) == 0 && len(d.Connections) == 0 &&
+		len(d.Variables) == 0 && len(d.Files) == 0
+}
+
+// FieldChange is a changed field, with its old and new value. A value is nil
+// if the field is unset.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// ObjectChange is an object that was added, removed, or changed.
+type ObjectChange struct {
+	Change string `json:"change"`
+
+	// Old and New are the object in each workflow, nil if it was added or
+	// removed.
+	Old *InspectedObject `json:"old"`
+	New *InspectedObject `json:"new"`
+
+	// Fields are the changes of a changed object's UID, type, and config.
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// Object returns the object in the newer workflow, or in the older one if it
+// was removed.
+func (c ObjectChange) Object() InspectedObject {
+	if c.New != nil {
+		return *c.New
+	}
+	return *c.Old
+}
+
+// ConnectionChange is a connection that was added, removed, or changed. Its
+// objects are given by their UIDs in the newer workflow, or in the older one
+// if they were removed.
+type ConnectionChange struct {
+	Change string `json:"change"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Mod    string `json:"mod,omitempty"`
+
+	// Fields are the changes of a changed connection's modifier subtitle.
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// VariableChange is a variable that was added, removed, or changed.
+type VariableChange struct {
+	Change string             `json:"change"`
+	Old    *InspectedVariable `json:"old"`
+	New    *InspectedVariable `json:"new"`
+}
+
+// FileChange is a file that was added, removed, or whose contents changed.
+// info.plist is never listed, since its changes are diffed by field.
+type FileChange struct {
+	Change string         `json:"change"`
+	Old    *InspectedFile `json:"old"`
+	New    *InspectedFile `json:"new"`
+
+	// Diff is the line diff of a changed text file, in hunks as returned by
+	// textdiff.Hunks. It is empty for binary files and files longer than
+	// 2,000 lines.
+	Diff []string `json:"diff,omitempty"`
+}
+
+// Compare returns the difference from workflow a to workflow b. Objects are
+// matched by UID, which Alpaca derives from their names, and then by type and
+// keyword, so that an object keeps its identity when it is renamed.
+func Compare(a *Inspection, b *Inspection) *Diff {
+	d := Diff{
+		Metadata:    []FieldChange{},
+		Objects:     []ObjectChange{},
+		Connections: []ConnectionChange{},
+		Variables:   []VariableChange{},
+		Files:       []FileChange{},
+	}
+
+	for _, field := range []struct {
+		name          string
+		before, after string
+	}{
+		{"name", a.Name, b.Name},
+		{"bundle_id", a.BundleID, b.BundleID},
+		{"version", a.Version, b.Version},
+		{"author", a.Author, b.Author},
+		{"description", a.Description, b.Description},
+		{"web_address", a.WebAddress, b.WebAddress},
+	} {
+		if field.before != field.after {
+			d.Metadata = append(d.Metadata, FieldChange{Field: field.name, Old: field.before, New: field.after})
+		}
+	}
+
+	matches := matchObjects(a.Objects, b.Objects)
+
+	// uids maps the UIDs of objects in a to those of the objects they match
+	// in b, so that connections can be compared.
+	uids := make(map[string]string)
+	matched := make(map[string]bool)
+	for i := range a.Objects {
+		before := &a.Objects[i]
+		j, ok := matches[i]
+		if !ok {
+			d.Objects = append(d.Objects, ObjectChange{Change: Removed, Old: before})
+			continue
+		}
+
+		after := &b.Objects[j]
+		uids[before.UID] = after.UID
+		matched[after.UID] = true
+
+		if fields := objectFields(*before, *after); len(fields) > 0 {
+			d.Objects = append(d.Objects, ObjectChange{Change: Changed, Old: before, New: after, Fields: fields})
+		}
+	}
+	for i := range b.Objects {
+		if !matched[b.Objects[i].UID] {
+			d.Objects = append(d.Objects, ObjectChange{Change: Added, New: &b.Objects[i]})
+		}
+	}
+
+	d.Connections = compareConnections(a.Connections, b.Connections, uids)
+	d.Variables = compareVariables(a.Variables, b.Variables)
+	d.Files = compareFiles(a, b)
+
+	return &d
+}
+
+// matchObjects returns the index of the object in b that each object in a
+// matches: the object with the same UID, or else the only unmatched object
+// with the same type and keyword.
+func matchObjects(a []InspectedObject, b []InspectedObject) map[int]int {
+	matches := make(map[int]int)
+	taken := make(map[int]bool)
+
+	byUID := make(map[string]int)
+	for j, obj := range b {
+		byUID[obj.UID] = j
+	}
+	for i, obj := range a {
+		if j, ok := byUID[obj.UID]; ok {
+			matches[i] = j
+			taken[j] = true
+		}
+	}
+
+	identity := func(obj InspectedObject) string {
+		keyword, _ := obj.Config["keyword"].(string)
+		if keyword == "" {
+			return ""
+		}
+		return obj.Type + " " + keyword
+	}
+
+	candidates := make(map[string][]int)
+	for j, obj := range b {
+		if id := identity(obj); id != "" && !taken[j] {
+			candidates[id] = append(candidates[id], j)
+		}
+	}
+	unmatched := make(map[string][]int)
+	for i, obj := range a {
+		if _, ok := matches[i]; !ok {
+			if id := identity(obj); id != "" {
+				unmatched[id] = append(unmatched[id], i)
+			}
+		}
+	}
+	for id, is := range unmatched {
+		if js := candidates[id]; len(is) == 1 && len(js) == 1 {
+			matches[is[0]] = js[0]
+		}
+	}
+
+	return matches
+}
+
+// objectFields returns the changes between two matched objects.
+func objectFields(before InspectedObject, after InspectedObject) []FieldChange {
+	var fields []FieldChange
+	if before.UID != after.UID {
+		fields = append(fields, FieldChange{Field: "uid", Old: before.UID, New: after.UID})
+	}
+	if before.Type != after.Type {
+		fields = append(fields, FieldChange{Field: "type", Old: before.Type, New: after.Type})
+	}
+	return append(fields, compareMaps(before.Config, after.Config)...)
+}
+
+// compareMaps returns the changes between two maps, in order of their keys.
+func compareMaps(before map[string]interface{}, after map[string]interface{}) []FieldChange {
+	var keys []string
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		keys = append(keys, key)
+	}
+
+	var fields []FieldChange
+	for _, key := range sortedUnion(keys) {
+		if !reflect.DeepEqual(before[key], after[key]) {
+			fields = append(fields, FieldChange{Field: key, Old: before[key], New: after[key]})
+		}
+	}
+	return fields
+}
+
+// compareConnections returns the connections added, removed, or changed. A
+// connection is identified by its objects and modifier keys.
+func compareConnections(a []InspectedConnection, b []InspectedConnection, uids map[string]string) []ConnectionChange {
+	type key struct{ from, to, mod string }
+
+	translate := func(uid string) string {
+		if translated, ok := uids[uid]; ok {
+			return translated
+		}
+		return uid
+	}
+
+	before := make(map[key]InspectedConnection)
+	for _, conn := range a {
+		before[key{translate(conn.From), translate(conn.To), conn.Mod}] = conn
+	}
+
+	changes := []ConnectionChange{}
+	seen := make(map[key]bool)
+	for _, conn := range b {
+		k := key{conn.From, conn.To, conn.Mod}
+		seen[k] = true
+
+		prev, ok := before[k]
+		switch {
+		case !ok:
+			changes = append(changes, ConnectionChange{Change: Added, From: conn.From, To: conn.To, Mod: conn.Mod})
+		case prev.ModSubtitle != conn.ModSubtitle:
+			changes = append(changes, ConnectionChange{
+				Change: Changed,
+				From:   conn.From,
+				To:     conn.To,
+				Mod:    conn.Mod,
+				Fields: []FieldChange{{Field: "mod_subtitle", Old: prev.ModSubtitle, New: conn.ModSubtitle}},
+			})
+		}
+	}
+
+	for _, conn := range a {
+		k := key{translate(conn.From), translate(conn.To), conn.Mod}
+		if !seen[k] {
+			changes = append(changes, ConnectionChange{Change: Removed, From: k.from, To: k.to, Mod: conn.Mod})
+		}
+	}
+
+	return changes
+}
+
+// compareVariables returns the variables added, removed, or whose value or
+// export changed, in order of name.
+func compareVariables(a []InspectedVariable, b []InspectedVariable) []VariableChange {
+	var names []string
+	before := make(map[string]*InspectedVariable)
+	for i := range a {
+		before[a[i].Name] = &a[i]
+		names = append(names, a[i].Name)
+	}
+	after := make(map[string]*InspectedVariable)
+	for i := range b {
+		after[b[i].Name] = &b[i]
+		names = append(names, b[i].Name)
+	}
+
+	changes := []VariableChange{}
+	for _, name := range sortedUnion(names) {
+		o, n := before[name], after[name]
+		switch {
+		case o == nil:
+			changes = append(changes, VariableChange{Change: Added, New: n})
+		case n == nil:
+			changes = append(changes, VariableChange{Change: Removed, Old: o})
+		case *o != *n:
+			changes = append(changes, VariableChange{Change: Changed, Old: o, New: n})
+		}
+	}
+
+	return changes
+}
+
+// compareFiles returns the files added, removed, or whose contents changed,
+// in order of path, with the line diffs of changed text files.
+func compareFiles(a *Inspection, b *Inspection) []FileChange {
+	var paths []string
+	before := make(map[string]*InspectedFile)
+	for i := range a.Files {
+		before[a.Files[i].Path] = &a.Files[i]
+		paths = append(paths, a.Files[i].Path)
+	}
+	after := make(map[string]*InspectedFile)
+	for i := range b.Files {
+		after[b.Files[i].Path] = &b.Files[i]
+		paths = append(paths, b.Files[i].Path)
+	}
+
+	changes := []FileChange{}
+	for _, path := range sortedUnion(paths) {
+		if path == "info.plist" {
+			continue
+		}
+
+		o, n := before[path], after[path]
+		switch {
+		case o == nil:
+			changes = append(changes, FileChange{Change: Added, New: n})
+		case n == nil:
+			changes = append(changes, FileChange{Change: Removed, Old: o})
+		case !bytes.Equal(a.contents[path], b.contents[path]):
+			changes = append(changes, FileChange{
+				Change: Changed,
+				Old:    o,
+				New:    n,
+				Diff:   diffText(a.contents[path], b.contents[path]),
+			})
+		}
+	}
+
+	return changes
+}
+
+// diffText returns the line diff of two versions of a file, or nil if either
+// is binary or too large to diff.
+func diffText(before []byte, after []byte) []string {
+	for _, data := range [][]byte{before, after} {
+		if bytes.Count(data, []byte("\n")) >= maxDiffLines || !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+			return nil
+		}
+	}
+
+	lines := textdiff.Lines(strings.TrimSuffix(string(before), "\n"), strings.TrimSuffix(string(after), "\n"))
+	return textdiff.Hunks(lines, diffContext)
+}
+
+// sortedUnion returns the distinct strings of a list, sorted.
+func sortedUnion(list []string) []string {
+	seen := make(map[string]bool)
+	var union []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			union = append(union, s)
+		}
+	}
+	sort.Strings(union)
+	return union
+}
@@ -0,0 +1,246 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jclem/alpaca/config"
+)
+
+const (
+	nodeWidth      = 160
+	nodeHeight     = 80
+	nodeLineHeight = 18
+)
+
+// Graph is the graph of a workflow's objects and their connections, laid out
+// as they are in Alfred's workflow editor.
+type Graph struct {
+	Name  string
+	Nodes []Node
+	Edges []Edge
+}
+
+// Node is an object in a workflow graph, positioned by its uidata.
+type Node struct {
+	Name    string
+	Type    config.ObjectType
+	Keyword string
+	X       int64
+	Y       int64
+}
+
+// Lines returns the lines of the node's label: its name, type, and keyword,
+// if any.
+func (n Node) Lines() []string {
+	lines := []string{n.Name, string(n.Type)}
+	if n.Keyword != "" {
+		lines = append(lines, "keyword: "+n.Keyword)
+	}
+	return lines
+}
+
+// Edge is a connection between two objects in a workflow graph.
+type Edge struct {
+	From string
+	To   string
+
+	// Mod is the combination of modifier keys, joined by "+", that must be
+	// held to follow the connection, if any.
+	Mod string
+
+	// ModSubtitle is the subtitle shown while the modifier keys are held.
+	ModSubtitle string
+}
+
+// Label returns the label of the edge: its modifier keys and their subtitle,
+// if any.
+func (e Edge) Label() string {
+	if e.ModSubtitle == "" {
+		return e.Mod
+	}
+	if e.Mod == "" {
+		return e.ModSubtitle
+	}
+	return e.Mod + ": " + e.ModSubtitle
+}
+
+// NewGraph returns the graph of the workflow built from a config. Nodes are
+// in name order, and edges in the order of their source's name and then
+// list.
+func NewGraph(c config.Config) (*Graph, error) {
+	info, err := NewFromConfig("", c)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(c.Objects))
+	for name := range c.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	g := Graph{Name: c.Name}
+	for _, name := range names {
+		obj := c.Objects[name]
+		pos := info.UIData[obj.UID]
+
+		g.Nodes = append(g.Nodes, Node{
+			Name:    name,
+			Type:    obj.Type,
+			Keyword: obj.Keyword(),
+			X:       pos.XPos,
+			Y:       pos.YPos,
+		})
+
+		for _, then := range obj.Then {
+			g.Edges = append(g.Edges, Edge{From: name, To: then.Object, Mod: then.Mod, ModSubtitle: then.ModSubtitle})
+		}
+	}
+
+	return &g, nil
+}
+
+// DOT returns the graph in the Graphviz DOT language.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "digraph %s {\n", dotQuote(g.Name))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(node.Name), dotQuote(strings.Join(node.Lines(), "\n")))
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s -> %s", dotQuote(edge.From), dotQuote(edge.To))
+		if label := edge.Label(); label != "" {
+			fmt.Fprintf(&b, " [label=%s]", dotQuote(label))
+		}
+		b.WriteString(";\n")
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// dotQuote returns s as a quoted DOT string, with newlines as line breaks.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Mermaid returns the graph as a Mermaid flowchart. Nodes are identified by
+// their position in the graph, since object names may contain characters
+// that Mermaid doesn't allow in IDs.
+func (g *Graph) Mermaid() string {
+	var b strings.Builder
+
+	ids := make(map[string]string, len(g.Nodes))
+	b.WriteString("flowchart LR\n")
+
+	for i, node := range g.Nodes {
+		ids[node.Name] = fmt.Sprintf("n%d", i)
+
+		lines := node.Lines()
+		for j, line := range lines {
+			lines[j] = mermaidEscape(line)
+		}
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[node.Name], strings.Join(lines, "<br/>"))
+	}
+
+	for _, edge := range g.Edges {
+		if label := edge.Label(); label != "" {
+			fmt.Fprintf(&b, "  %s -->|\"%s\"| %s\n", ids[edge.From], mermaidEscape(label), ids[edge.To])
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+		}
+	}
+
+	return b.String()
+}
+
+// mermaidEscape escapes the characters of a Mermaid label that would end it
+// or be read as markup.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+// SVG returns the graph as a self-contained SVG image, with each node at its
+// position in Alfred's workflow editor.
+func (g *Graph) SVG() string {
+	pos := make(map[string]Node, len(g.Nodes))
+	var width, height int64
+	for _, node := range g.Nodes {
+		pos[node.Name] = node
+		if w := node.X + nodeWidth + xPadding; w > width {
+			width = w
+		}
+		if h := node.Y + nodeHeight + yPadding; h > height {
+			height = h
+		}
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+	b.WriteString(`  <title>` + xmlEscape(g.Name) + "</title>\n")
+	b.WriteString(`  <style>
+    text { font-family: -apple-system, "Helvetica Neue", sans-serif; font-size: 12px; fill: #333; }
+    .node rect { fill: #fff; stroke: #999; }
+    .node .name { font-weight: bold; font-size: 13px; }
+    .edge path { fill: none; stroke: #666; }
+    .edge text { font-size: 11px; stroke: #fff; stroke-width: 3px; paint-order: stroke; }
+  </style>
+  <defs>
+    <marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto">
+      <path d="M 0 0 L 10 5 L 0 10 z" fill="#666"/>
+    </marker>
+  </defs>
+`)
+
+	for _, edge := range g.Edges {
+		from, to := pos[edge.From], pos[edge.To]
+		x1, y1 := from.X+nodeWidth, from.Y+nodeHeight/2
+		x2, y2 := to.X, to.Y+nodeHeight/2
+		mx := (x1 + x2) / 2
+
+		b.WriteString(`  <g class="edge">` + "\n")
+		fmt.Fprintf(&b, `    <path d="M %d %d C %d %d, %d %d, %d %d" marker-end="url(#arrow)"/>`+"\n", x1, y1, mx, y1, mx, y2, x2, y2)
+		if label := edge.Label(); label != "" {
+			fmt.Fprintf(&b, `    <text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n", mx, (y1+y2)/2-4, xmlEscape(label))
+		}
+		b.WriteString("  </g>\n")
+	}
+
+	for _, node := range g.Nodes {
+		b.WriteString(`  <g class="node">` + "\n")
+		fmt.Fprintf(&b, `    <rect x="%d" y="%d" width="%d" height="%d" rx="8"/>`+"\n", node.X, node.Y, nodeWidth, nodeHeight)
+
+		lines := node.Lines()
+		top := node.Y + (nodeHeight-int64(len(lines)-1)*nodeLineHeight)/2 + 4
+		for i, line := range lines {
+			class := ""
+			if i == 0 {
+				class = ` class="name"`
+			}
+			fmt.Fprintf(&b, `    <text x="%d" y="%d" text-anchor="middle"%s>%s</text>`+"\n", node.X+nodeWidth/2, top+int64(i)*nodeLineHeight, class, xmlEscape(line))
+		}
+
+		b.WriteString("  </g>\n")
+	}
+
+	b.WriteString("</svg>\n")
+
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
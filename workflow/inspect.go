@@ -0,0 +1,207 @@
+package workflow
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/groob/plist"
+	"github.com/jclem/alpaca/config"
+)
+
+// Inspection is a summary of a packed workflow, with the codes in its
+// info.plist decoded back to their names in an Alpaca config.
+type Inspection struct {
+	Name        string `json:"name"`
+	BundleID    string `json:"bundle_id"`
+	Version     string `json:"version"`
+	Author      string `json:"author"`
+	Description string `json:"description"`
+	WebAddress  string `json:"web_address"`
+
+	Objects     []InspectedObject     `json:"objects"`
+	Connections []InspectedConnection `json:"connections"`
+	Variables   []InspectedVariable   `json:"variables"`
+	Files       []InspectedFile       `json:"files"`
+
+	// contents are the contents of the files by path, which Compare diffs.
+	contents map[string][]byte
+}
+
+// InspectedObject is an object of a packed workflow.
+type InspectedObject struct {
+	UID string `json:"uid"`
+
+	// Name is the name of the object in the project's config, which is only
+	// known for a workflow built from a project.
+	Name string `json:"name,omitempty"`
+
+	// Type is the type of the object in an Alpaca config, or its type in the
+	// workflow if Alpaca doesn't know it.
+	Type string `json:"type"`
+
+	Version int64 `json:"version,omitempty"`
+
+	// Config is the object's config, decoded by config.DecodeWorkflowConfig.
+	Config map[string]interface{} `json:"config"`
+}
+
+// Label returns a short description of the object: its type, and its keyword
+// or title, if any.
+func (o InspectedObject) Label() string {
+	for _, key := range []string{"keyword", "title", "text"} {
+		if s, ok := o.Config[key].(string); ok && s != "" {
+			return fmt.Sprintf("%s %q", o.Type, s)
+		}
+	}
+	return o.Type
+}
+
+// InspectedConnection is a connection between two objects of a packed
+// workflow, given by their UIDs.
+type InspectedConnection struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Mod is the combination of modifier keys, joined by "+", that must be
+	// held to follow the connection, if any.
+	Mod         string `json:"mod,omitempty"`
+	ModSubtitle string `json:"mod_subtitle,omitempty"`
+}
+
+// InspectedVariable is a variable of a packed workflow. A variable that is
+// not exported is omitted when the workflow is exported from Alfred.
+type InspectedVariable struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Exported bool   `json:"exported"`
+}
+
+// InspectedFile is a file in a packed workflow.
+type InspectedFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Inspect returns a summary of the workflow file at path.
+func Inspect(path string) (*Inspection, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	return inspect(path, archive.File)
+}
+
+// InspectData returns a summary of a packed workflow in memory, such as one
+// written to a project.NewZipOutput. The name identifies it in errors.
+func InspectData(name string, data []byte) (*Inspection, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	return inspect(name, archive.File)
+}
+
+func inspect(path string, files []*zip.File) (*Inspection, error) {
+	var info *Info
+	inspection := Inspection{
+		Objects:     []InspectedObject{},
+		Connections: []InspectedConnection{},
+		Variables:   []InspectedVariable{},
+		Files:       []InspectedFile{},
+		contents:    make(map[string][]byte),
+	}
+
+	for _, file := range files {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		data, err := readZipFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read %s in %s: %s", file.Name, path, err)
+		}
+
+		inspection.Files = append(inspection.Files, InspectedFile{Path: file.Name, Size: int64(len(data))})
+		inspection.contents[file.Name] = data
+
+		if file.Name == "info.plist" {
+			info = new(Info)
+			if err := plist.Unmarshal(data, info); err != nil {
+				return nil, fmt.Errorf("Invalid info.plist in %s: %s", path, err)
+			}
+		}
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("%s has no info.plist", path)
+	}
+
+	sort.Slice(inspection.Files, func(i, j int) bool { return inspection.Files[i].Path < inspection.Files[j].Path })
+
+	inspection.Name = info.Name
+	inspection.BundleID = info.BundleID
+	inspection.Version = info.Version
+	inspection.Author = info.CreatedBy
+	inspection.Description = info.Description
+	inspection.WebAddress = info.WebAddress
+
+	for _, obj := range info.Objects {
+		o := InspectedObject{Config: map[string]interface{}{}}
+		o.UID, _ = obj["uid"].(string)
+
+		workflowType, _ := obj["type"].(string)
+		o.Type = workflowType
+		if t, ok := config.ObjectTypeOf(workflowType); ok {
+			o.Type = string(t)
+		}
+
+		switch version := obj["version"].(type) {
+		case uint64:
+			o.Version = int64(version)
+		case int64:
+			o.Version = version
+		}
+
+		if cfg, ok := obj["config"].(map[string]interface{}); ok {
+			o.Config = config.DecodeWorkflowConfig(workflowType, cfg)
+		}
+
+		inspection.Objects = append(inspection.Objects, o)
+
+		for _, conn := range info.Connections[o.UID] {
+			inspection.Connections = append(inspection.Connections, InspectedConnection{
+				From:        o.UID,
+				To:          conn.To,
+				Mod:         config.ModifierNames(conn.Modifiers),
+				ModSubtitle: conn.ModifierSubtext,
+			})
+		}
+	}
+
+	unexported := make(map[string]bool)
+	for _, name := range info.VariablesDontExport {
+		unexported[name] = true
+	}
+	for name, value := range info.Variables {
+		inspection.Variables = append(inspection.Variables, InspectedVariable{Name: name, Value: value, Exported: !unexported[name]})
+	}
+	sort.Slice(inspection.Variables, func(i, j int) bool { return inspection.Variables[i].Name < inspection.Variables[j].Name })
+
+	return &inspection, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
@@ -27,7 +27,7 @@ func (i *Info) buildUIData() {
 	// Sort for testing stability
 	sortedObjs := make([]map[string]interface{}, len(i.Objects))
 	copy(sortedObjs, i.Objects)
-	sort.Slice(sortedObjs, func(i, j int) bool {
+	sort.SliceStable(sortedObjs, func(i, j int) bool {
 		iType := sortedObjs[i]["type"].(string)
 		jType := sortedObjs[j]["type"].(string)
 		return iType < jType
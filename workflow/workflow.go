@@ -2,6 +2,7 @@ package workflow
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/jclem/alpaca/config"
 )
@@ -40,9 +41,19 @@ func NewFromConfig(path string, c config.Config) (*Info, error) {
 	for varName := range i.Variables {
 		i.VariablesDontExport = append(i.VariablesDontExport, varName)
 	}
+	sort.Strings(i.VariablesDontExport)
+
+	// Visit objects in name order, so that the same config always produces
+	// the same workflow.
+	names := make([]string, 0, len(c.Objects))
+	for name := range c.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
 	// Build workflow connections.
-	for _, cfgObj := range c.Objects {
+	for _, name := range names {
+		cfgObj := c.Objects[name]
 		for _, then := range cfgObj.Then {
 			conns, ok := i.Connections[cfgObj.UID]
 			if !ok {
@@ -61,15 +72,20 @@ func NewFromConfig(path string, c config.Config) (*Info, error) {
 				return nil, fmt.Errorf("Could not find object %q", then.Object)
 			}
 
+			// Modifiers are validated when the config is read.
+			modifiers, _ := config.ModifierMask(then.Mod)
+
 			i.Connections[cfgObj.UID] = append(conns, Connection{
-				To: uid,
+				To:              uid,
+				Modifiers:       modifiers,
+				ModifierSubtext: then.ModSubtitle,
 			})
 		}
 	}
 
 	// Build workflow objects.
-	for _, cfgObj := range c.Objects {
-		obj := cfgObj.ToWorkflowConfig()
+	for _, name := range names {
+		obj := c.Objects[name].ToWorkflowConfig()
 		i.Objects = append(i.Objects, obj)
 	}
 